@@ -2,110 +2,206 @@ package evaluator
 
 import (
 	"fmt"
-	"strconv"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/guiyuanju/golisp/expr"
 )
 
-type Proc func(e Evaluator, exprs ...expr.Expr) (expr.Expr, bool)
+type Proc func(e Evaluator, exprs ...expr.Expr) (expr.Expr, error)
 
+// Builtins is a set of builtin procedures by name. Sets can be composed with
+// Compose and shared between evaluators, each evaluator keeps its own copy.
 type Builtins map[string]Proc
 
+// RegisteredBuiltins is the default layer of host functions, registered by
+// RegisterBuiltin and included in every evaluator created by New.
 var RegisteredBuiltins Builtins = Builtins{}
 
+var registeredMu sync.RWMutex
+
 func registerBuiltin(name string, proc Proc) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
 	RegisteredBuiltins[name] = proc
 }
 
+// RegisterBuiltin registers f in the default layer, evaluators created by
+// New afterwards can call it by name.
 func RegisterBuiltin(name string, f func(...any) (any, error)) {
-	var proc Proc
-	proc = func(e Evaluator, params ...expr.Expr) (expr.Expr, bool) {
+	registerBuiltin(name, hostProc(f))
+}
+
+// GlobalBuiltins returns a snapshot of the default layer.
+func GlobalBuiltins() Builtins {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	return Compose(RegisteredBuiltins)
+}
+
+// hostProc adapts a Go function to a Proc, converting arguments and the result
+// between GoLisp and Go values.
+func hostProc(f func(...any) (any, error)) Proc {
+	return func(e Evaluator, params ...expr.Expr) (expr.Expr, error) {
 		args := []any{}
 		for i := 1; i < len(params); i++ {
-			args = append(args, expr.GVal(params[i]))
+			args = append(args, e.gval(params[i]))
 		}
 		res, err := f(args...)
 		if err != nil {
-			fmt.Println(e.errorInfo("repl", expr.NewBuiltin(name), err.Error()))
-			return nil, false
+			return nil, e.hostError(err, params[0])
 		}
-		return expr.LVal(res), true
+		return expr.LVal(res), nil
+	}
+}
+
+// Compose returns a new set with the builtins of all sets, later sets
+// override earlier ones.
+func Compose(sets ...Builtins) Builtins {
+	res := Builtins{}
+	for _, set := range sets {
+		for name, proc := range set {
+			res[name] = proc
+		}
+	}
+	return res
+}
+
+// Register adds f to the set.
+func (b Builtins) Register(name string, f func(...any) (any, error)) {
+	b[name] = hostProc(f)
+}
+
+// RegisterProc adds proc to the set.
+func (b Builtins) RegisterProc(name string, proc Proc) {
+	b[name] = proc
+}
+
+// DefaultBuiltins returns the core builtins of the language.
+func DefaultBuiltins() Builtins {
+	return Builtins{
+		"+":             plus,
+		"-":             minus,
+		"*":             multiply,
+		"/":             divide,
+		"quot":          quot,
+		"mod":           mod,
+		"round":         round,
+		"decimal":       decimal,
+		"print":         print,
+		"do":            do,
+		"=":             equal,
+		">":             greater,
+		"<":             less,
+		"<=":            lessEqual,
+		">=":            greaterEqual,
+		"append":        _append,
+		":":             slice,
+		"list":          list,
+		"vector":        vector,
+		"range":         _range,
+		"not":           not,
+		"type":          _type,
+		"int?":          isType("int"),
+		"float?":        isType("float"),
+		"bigint?":       isType("bigint"),
+		"decimal?":      isType("decimal"),
+		"number?":       isType("int", "float", "bigint", "decimal"),
+		"string?":       isType("string"),
+		"symbol?":       isType("symbol"),
+		"bool?":         isType("bool"),
+		"nil?":          isType("nil"),
+		"list?":         isType("list"),
+		"vector?":       isType("vector"),
+		"map?":          isType("map"),
+		"fn?":           isType("closure", "builtin"),
+		"macroexpand":   macroexpand,
+		"time":          _time,
+		".":             dot,
+		"..":            member,
+		"error":         _error,
+		"error?":        isError,
+		"error-message": errorMessage,
+		"error-data":    errorData,
+		"error-kind":    errorKind,
+		"len":           length,
+		"eval":          eval,
+		"gensym":        _gensym,
+		"hash-map":      hashMap,
+		"get":           get,
+		"assoc":         assoc,
+		"dissoc":        dissoc,
+		"keys":          keys,
+		"vals":          vals,
+		"contains?":     contains,
+		"merge":         merge,
+		"update":        update,
 	}
-	registerBuiltin(name, proc)
 }
 
+// RegisterDefaultBuiltins adds the core builtins to the default layer.
+//
+// Deprecated: core builtins are always included by New and NewWith.
 func RegisterDefaultBuiltins() {
-	RegisteredBuiltins["+"] = plus
-	RegisteredBuiltins["-"] = minus
-	RegisteredBuiltins["*"] = multiply
-	RegisteredBuiltins["/"] = divide
-	RegisteredBuiltins["print"] = print
-	RegisteredBuiltins["do"] = do
-	RegisteredBuiltins["="] = equal
-	RegisteredBuiltins[">"] = greater
-	RegisteredBuiltins["<"] = less
-	RegisteredBuiltins["<="] = lessEqual
-	RegisteredBuiltins[">="] = greaterEqual
-	RegisteredBuiltins["append"] = _append
-	RegisteredBuiltins[":"] = slice
-	RegisteredBuiltins["list"] = list
-	RegisteredBuiltins["not"] = not
-	RegisteredBuiltins["type"] = _type
-	RegisteredBuiltins["macroexpand"] = macroexpand
-	RegisteredBuiltins["time"] = _time
-	RegisteredBuiltins["."] = dot
-	RegisteredBuiltins["len"] = length
-	RegisteredBuiltins["eval"] = eval
-}
-
-func eval(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+	for name, proc := range DefaultBuiltins() {
+		registerBuiltin(name, proc)
+	}
+}
+
+func _gensym(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 {
+		return gensym("g"), nil
+	}
+	switch prefix := values[1].(type) {
+	case expr.String:
+		return gensym(prefix.Value), nil
+	case expr.Symbol:
+		return gensym(prefix.Value), nil
+	default:
+		return nil, e.error(TypeError, values[1], "expect a string or symbol prefix")
+	}
+}
+
+func eval(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	return e.Eval(values[1])
 }
 
-func slice(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func slice(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 4 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need 3 arguments"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need 3 arguments")
 	}
-	start, ok := values[1].(expr.Number)
+	start, ok := values[1].(expr.Int)
 	if !ok {
-		fmt.Println(e.errorInfo("repl", values[0], "expect int"))
-		return nil, false
+		return nil, e.error(TypeError, values[1], "expect int")
 	}
-	end, ok := values[2].(expr.Number)
+	end, ok := values[2].(expr.Int)
 	if !ok {
-		fmt.Println(e.errorInfo("repl", values[0], "expect int"))
-		return nil, false
-	}
-	switch seq := values[3].(type) {
-	case expr.List:
-		startIdx := int(start.Value)
-		if startIdx < 0 {
-			startIdx += len(seq.Value)
-		}
-		if startIdx < 0 || startIdx > len(seq.Value) {
-			fmt.Println(e.errorInfo("repl", values[1], fmt.Sprintf("index %d out of bound %d", startIdx, len(seq.Value))))
-			return nil, false
-		}
-		endIdx := int(end.Value)
-		if endIdx < 0 {
-			endIdx += len(seq.Value)
-		}
-		if endIdx < 0 || endIdx > len(seq.Value) {
-			fmt.Println(e.errorInfo("repl", values[1], fmt.Sprintf("index %d out of bound %d", startIdx, len(seq.Value))))
-			return nil, false
-		}
-		if startIdx > endIdx {
-			fmt.Println(e.errorInfo("repl", values[1], "start is greater than end"))
-			return nil, false
-		}
-		return expr.NewList(seq.Value[startIdx:endIdx]...), true
-
-	default:
-		fmt.Println(e.errorInfo("repl", values[3], "expect vector or list"))
-		return nil, false
+		return nil, e.error(TypeError, values[2], "expect int")
+	}
+	seq, ok := values[3].(expr.Seq)
+	if !ok {
+		return nil, e.error(TypeError, values[3], "expect vector or list")
+	}
+	startIdx := int(start.Value)
+	if startIdx < 0 {
+		startIdx += seq.Len()
+	}
+	if startIdx < 0 || startIdx > seq.Len() {
+		return nil, e.error(IndexError, values[1], fmt.Sprintf("index %d out of bound %d", startIdx, seq.Len()))
+	}
+	endIdx := int(end.Value)
+	if endIdx < 0 {
+		endIdx += seq.Len()
 	}
+	if endIdx < 0 || endIdx > seq.Len() {
+		return nil, e.error(IndexError, values[2], fmt.Sprintf("index %d out of bound %d", endIdx, seq.Len()))
+	}
+	if startIdx > endIdx {
+		return nil, e.error(IndexError, values[1], "start is greater than end")
+	}
+	return seq.Slice(startIdx, endIdx), nil
 }
 
 func formalizeIndex(idx int, length int) (int, bool) {
@@ -119,251 +215,203 @@ func formalizeIndex(idx int, length int) (int, bool) {
 	return index, true
 }
 
-func length(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func length(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 2 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need 1 argument"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need 1 argument")
 	}
 	switch seq := values[1].(type) {
-	case expr.List:
-		return expr.NewNum(float64(len(seq.Value))), true
+	case expr.Seq:
+		return expr.NewInt(int64(seq.Len())), nil
+	case expr.Map:
+		return expr.NewInt(int64(seq.Len())), nil
 	default:
-		fmt.Println(e.errorInfo("repl", values[1], "unsupported type for len"))
-		return nil, false
+		return nil, e.error(TypeError, values[1], "unsupported type for len")
 	}
 }
 
-func dot(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func dot(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 3 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need 2 arguments"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need 2 arguments")
 	}
 	switch seq := values[2].(type) {
-	case expr.List:
-		v, ok := values[1].(expr.Number)
+	case expr.Seq:
+		v, ok := values[1].(expr.Int)
 		if !ok {
-			fmt.Println(e.errorInfo("repl", values[2], "expect int"))
-			return nil, false
+			return nil, e.error(TypeError, values[1], "expect int")
 		}
-		idx, ok := formalizeIndex(int(v.Value), len(seq.Value))
+		idx, ok := formalizeIndex(int(v.Value), seq.Len())
 		if !ok {
-			fmt.Println(e.errorInfo("repl", values[1], fmt.Sprintf("index %d out of bound %d", idx, len(seq.Value))))
-			return nil, false
+			return nil, e.error(IndexError, values[1], fmt.Sprintf("index %d out of bound %d", idx, seq.Len()))
 		}
-		return seq.Value[idx], true
+		return seq.Get(idx), nil
 	default:
-		fmt.Println(e.errorInfo("repl", values[2], "unsupported type for dot"))
-		return nil, false
-	}
-}
-
-func multiply(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	if len(values) < 3 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need at least 2 argumte"))
-		return nil, false
-	}
-	var res float64 = 1
-	for _, v := range values[1:] {
-		n, ok := v.(expr.Number)
-		if !ok {
-			fmt.Println(e.errorInfo("repl", values[0], "expect int"))
-			return nil, false
-		}
-		res *= n.Value
+		return nil, e.error(TypeError, values[2], "unsupported type for dot")
 	}
-	return expr.NewNum(res), true
 }
 
-func divide(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	if len(values) < 3 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need at least 2 argumte"))
-		return nil, false
-	}
-	v, ok := values[1].(expr.Number)
-	if !ok {
-		fmt.Println(e.errorInfo("repl", values[0], "expect int"))
-		return nil, false
-	}
-	res := v.Value
-	for _, v := range values[2:] {
-		n, ok := v.(expr.Number)
-		if !ok {
-			fmt.Println(e.errorInfo("repl", values[0], "expect int"))
-			return nil, false
-		}
-		res /= n.Value
-	}
-	return expr.NewNum(res), true
-}
-
-func _time(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func _time(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	nano := time.Now().UnixNano()
-	return expr.NewNum(float64(nano)), true
+	return expr.NewInt(nano), nil
 }
 
-func macroexpand(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func macroexpand(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 2 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need 1 argumte"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need 1 argumte")
 	}
 	arg, ok := values[1].(expr.List)
 	if !ok {
-		fmt.Println(e.errorInfo("repl", values[1], "expext argument to be a quoted list"))
-		return nil, false
+		return nil, e.error(TypeError, values[1], "expext argument to be a quoted list")
 	}
 	if !e.isMacro(arg.Value[0]) {
-		fmt.Println(e.errorInfo("repl", arg.Value[0], "not macro"))
-		return nil, false
+		return nil, e.error(TypeError, arg.Value[0], "not macro")
 	}
 	return e.macroExpand(arg)
 }
 
-func _type(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func _type(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 2 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need at least 1 argumte"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need at least 1 argumte")
+	}
+	return expr.NewString(values[1].ExprName()), nil
+}
+
+// isType returns a predicate true of values of the types, named as by type.
+func isType(types ...string) Proc {
+	return func(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+		if len(values) != 2 {
+			return nil, e.error(ArityError, values[0], "need 1 argument")
+		}
+		return expr.NewBool(slices.Contains(types, values[1].ExprName())), nil
 	}
-	return expr.NewString(values[1].ExprName()), true
 }
 
-func list(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	return expr.NewList(values[1:]...), true
+func list(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if err := e.checkListSize(len(values)-1, values[0]); err != nil {
+		return nil, err
+	}
+	return expr.NewList(values[1:]...), nil
 }
 
-func _append(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func _append(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 3 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need at least 2 argumtes"))
-		return nil, false
-	}
-	switch target := values[1].(type) {
-	case expr.List:
-		res := target.Value
-		for _, v := range values[2:] {
-			res = append(res, v)
-		}
-		return expr.NewList(res...), true
-	default:
-		fmt.Println(e.errorInfo("repl", values[1], "type mismatch:", "expect a list or vector"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need at least 2 argumtes")
+	}
+	target, ok := values[1].(expr.Seq)
+	if !ok {
+		return nil, e.error(TypeError, values[1], "expect a list or vector")
+	}
+	if err := e.checkListSize(target.Len()+len(values)-2, values[0]); err != nil {
+		return nil, err
 	}
+	return target.Append(values[2:]...), nil
 }
 
-func equal(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func vector(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if err := e.checkListSize(len(values)-1, values[0]); err != nil {
+		return nil, err
+	}
+	return expr.NewVector(values[1:]...), nil
+}
+
+func equal(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 3 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need at least 2 argumtes"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need at least 2 argumtes")
 	}
 	for i := 2; i < len(values); i++ {
-		if !values[i-1].Equal(values[i]) {
-			return expr.NewBool(false), true
+		if !equalValues(values[i-1], values[i]) {
+			return expr.NewBool(false), nil
 		}
 	}
-	return expr.NewBool(true), true
+	return expr.NewBool(true), nil
 }
 
-func not(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+// equalValues is Equal, but ints and floats of the same value are equal.
+func equalValues(a, b expr.Expr) bool {
+	if x, ok := toNum(a); ok {
+		if y, ok := toNum(b); ok {
+			return numEqual(x, y)
+		}
+	}
+	return a.Equal(b)
+}
+
+func not(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) < 2 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need at least 1 argumtes"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need at least 1 argumtes")
 	}
 	if isTruthy(values[1]) {
-		return expr.NewBool(false), true
+		return expr.NewBool(false), nil
 	}
-	return expr.NewBool(true), true
+	return expr.NewBool(true), nil
 }
 
-func less(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	gt, ok := greater(e, values...)
-	if !ok {
-		return gt, ok
-	}
-	eq, ok := equal(e, values...)
-	if !ok {
-		return eq, ok
-	}
-	return expr.NewBool(!gt.(expr.Bool).Value && !eq.(expr.Bool).Value), true
+func less(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	return ordered(e, values, func(c int) bool { return c < 0 })
 }
 
-func greaterEqual(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	eq, ok := equal(e, values...)
-	if !ok {
-		return eq, ok
-	}
-	if eq.(expr.Bool).Value {
-		return expr.NewBool(true), true
-	}
-	gt, ok := greater(e, values...)
-	if !ok {
-		return gt, ok
-	}
-	if gt.(expr.Bool).Value {
-		return expr.NewBool(true), true
-	}
-	return expr.NewBool(false), true
+func greaterEqual(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	return ordered(e, values, func(c int) bool { return c >= 0 })
 }
 
-func lessEqual(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	res, ok := greater(e, values...)
-	if !ok {
-		return nil, false
-	}
-	return not(e, []expr.Expr{values[0], res}...)
+func lessEqual(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	return ordered(e, values, func(c int) bool { return c <= 0 })
+}
+
+func greater(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	return ordered(e, values, func(c int) bool { return c > 0 })
 }
 
-func greater(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+// ordered reports whether holds is true of the comparison, -1, 0 or 1, of
+// each argument with the next. Numbers compare by value, a NaN to nothing,
+// strings lexically, with the numbers after a string by their printed form.
+func ordered(e Evaluator, values []expr.Expr, holds func(c int) bool) (expr.Expr, error) {
 	if len(values) < 3 {
-		fmt.Println(e.errorInfo("repl", values[0], "arity mismatch:", "need at least 2 argumtes"))
-		return nil, false
+		return nil, e.error(ArityError, values[0], "need at least 2 argumtes")
 	}
 	switch value := values[1].(type) {
-	case expr.Number:
-		prev := value.Value
+	case expr.Int, expr.Float, expr.BigInt, expr.Decimal:
+		prev, _ := toNum(value)
 		for i := 2; i < len(values); i++ {
-			if v, ok := values[i].(expr.Number); ok {
-				if v.Value >= prev {
-					return expr.NewBool(false), true
-				}
-				prev = v.Value
-			} else {
-				fmt.Println(e.errorInfo("repl", v, "expect int"))
-				return nil, false
+			v, ok := toNum(values[i])
+			if !ok {
+				return nil, e.error(TypeError, values[i], "expect a number")
+			}
+			if c, ok := numCompare(prev, v); !ok || !holds(c) {
+				return expr.NewBool(false), nil
 			}
+			prev = v
 		}
-		return expr.NewBool(true), true
+		return expr.NewBool(true), nil
 	case expr.String:
 		prev := value.Value
 		for i := 2; i < len(values); i++ {
+			var s string
 			switch v := values[i].(type) {
 			case expr.String:
-				if v.Value >= prev {
-					return expr.NewBool(false), true
-				}
-				prev = v.Value
-			case expr.Number:
-				str := strconv.FormatFloat(v.Value, 'f', -1, 64)
-				if str >= prev {
-					return expr.NewBool(false), true
-				}
-				prev = str
+				s = v.Value
+			case expr.Int, expr.Float, expr.BigInt, expr.Decimal:
+				s = v.String()
 			default:
-				fmt.Println(e.errorInfo("repl", v, "expect string or int"))
-				return nil, false
+				return nil, e.error(TypeError, values[i], "expect string or number")
+			}
+			if !holds(strings.Compare(prev, s)) {
+				return expr.NewBool(false), nil
 			}
+			prev = s
 		}
-		return expr.NewBool(true), true
+		return expr.NewBool(true), nil
 	}
-	fmt.Println(e.errorInfo("repl", values[1], "expect string or int"))
-	return nil, false
+	return nil, e.error(TypeError, values[1], "expect string or number")
 }
 
-func do(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	if len(values) == 0 {
-		return nil, true
+func do(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 {
+		return expr.NewNil(), nil
 	}
-	return values[len(values)-1], true
+	return values[len(values)-1], nil
 }
 
-func print(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
+func print(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
 	if len(values) > 1 {
 		fmt.Print(values[1])
 	}
@@ -371,72 +419,5 @@ func print(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
 		fmt.Print(" ", values[i])
 	}
 	fmt.Println()
-	return nil, true
-}
-
-func plus(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	op := values[0]
-	if len(values) < 3 {
-		fmt.Println(e.errorInfo("repl", op, "need at least two argument"))
-		return nil, false
-	}
-
-	switch value := values[1].(type) {
-	case expr.Number:
-		res := value.Value
-		for i := 2; i < len(values); i++ {
-			if v, ok := values[i].(expr.Number); ok {
-				res += v.Value
-			} else {
-				fmt.Println(e.errorInfo("repl", v, "expect int"))
-				return nil, false
-			}
-		}
-		return expr.NewNum(res), true
-	case expr.String:
-		res := value.Value
-		for i := 2; i < len(values); i++ {
-			switch v := values[i].(type) {
-			case expr.String:
-				res += v.Value
-			case expr.Number:
-				res += strconv.FormatFloat(v.Value, 'f', -1, 64)
-			default:
-				fmt.Println(e.errorInfo("repl", v, "expect string or int"))
-				return nil, false
-			}
-		}
-		return expr.NewString(res), true
-	}
-
-	fmt.Println(e.errorInfo("repl", values[1], "unsupported operand for +: expect int or string"))
-	return nil, false
-}
-
-func minus(e Evaluator, values ...expr.Expr) (expr.Expr, bool) {
-	op := values[0]
-	if len(values) < 2 {
-		fmt.Println(e.errorInfo("repl", op, "need at least one argument"))
-		return nil, false
-	}
-
-	switch values[1].(type) {
-	case expr.Number:
-		if len(values) == 1 {
-			return expr.NewNum(-values[1].(expr.Number).Value), true
-		}
-		res := values[1].(expr.Number).Value
-		for i := 2; i < len(values); i++ {
-			if v, ok := values[i].(expr.Number); ok {
-				res -= v.Value
-			} else {
-				fmt.Println(e.errorInfo("repl", v, "expect int"))
-				return nil, false
-			}
-		}
-		return expr.NewNum(res), true
-	}
-
-	fmt.Println(e.errorInfo("repl", values[1], "unsupported operand for -: expect int"))
-	return nil, false
+	return expr.NewNil(), nil
 }
@@ -0,0 +1,64 @@
+package evaluator
+
+import "github.com/guiyuanju/golisp/expr"
+
+// (error message data?) returns an error value, for throw.
+func _error(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) != 2 && len(values) != 3 {
+		return nil, e.error(ArityError, values[0], "need a message and optional data")
+	}
+	msg, ok := values[1].(expr.String)
+	if !ok {
+		return nil, e.error(TypeError, values[1], "expect a message string, got", values[1].ExprName())
+	}
+	var data expr.Expr
+	if len(values) == 3 {
+		data = values[2]
+	}
+	return expr.NewError(msg.Value, data), nil
+}
+
+func isError(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) != 2 {
+		return nil, e.error(ArityError, values[0], "need 1 argument")
+	}
+	_, ok := values[1].(expr.Error)
+	return expr.NewBool(ok), nil
+}
+
+func (e Evaluator) toError(values []expr.Expr) (expr.Error, error) {
+	if len(values) != 2 {
+		return expr.Error{}, e.error(ArityError, values[0], "need 1 argument")
+	}
+	v, ok := values[1].(expr.Error)
+	if !ok {
+		return expr.Error{}, e.error(TypeError, values[1], "expect an error, got", values[1].ExprName())
+	}
+	return v, nil
+}
+
+func errorMessage(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	v, err := e.toError(values)
+	if err != nil {
+		return nil, err
+	}
+	return expr.NewString(v.Message), nil
+}
+
+func errorData(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	v, err := e.toError(values)
+	if err != nil {
+		return nil, err
+	}
+	return v.Data, nil
+}
+
+// (error-kind err) is "error" for thrown errors, else the kind of the failed
+// evaluation, e.g. "type error".
+func errorKind(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	v, err := e.toError(values)
+	if err != nil {
+		return nil, err
+	}
+	return expr.NewString(v.Kind), nil
+}
@@ -0,0 +1,199 @@
+package evaluator
+
+import (
+	"github.com/guiyuanju/golisp/expr"
+)
+
+func hashMap(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values)%2 == 0 {
+		return nil, e.error(ArityError, values[0], "expect an even number of arguments")
+	}
+	if err := e.checkListSize((len(values)-1)/2, values[0]); err != nil {
+		return nil, err
+	}
+	res := expr.NewMap()
+	for i := 1; i < len(values); i += 2 {
+		res.Value[expr.KeyOf(values[i])] = expr.MapEntry{Key: values[i], Value: values[i+1]}
+	}
+	return res, nil
+}
+
+// evalMap evaluates the keys and values of the map literal m, in the order of
+// keys. A map of constants is its own value.
+func (e Evaluator) evalMap(m expr.Map) (expr.Expr, error) {
+	constant := true
+	for _, entry := range m.Value {
+		constant = constant && isConstant(entry.Key) && isConstant(entry.Value)
+	}
+	if constant {
+		return m, nil
+	}
+	res := expr.NewMap()
+	for _, entry := range m.Entries() {
+		k, err := e.Eval(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := e.Eval(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		res.Value[expr.KeyOf(k)] = expr.MapEntry{Key: k, Value: v}
+	}
+	if err := e.checkListSize(res.Len(), m); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// isConstant reports whether e evaluates to itself.
+func isConstant(e expr.Expr) bool {
+	switch e.(type) {
+	case expr.Int, expr.Float, expr.BigInt, expr.Decimal, expr.String, expr.Bool, expr.Nil:
+		return true
+	}
+	return false
+}
+
+// toMap returns v as a map, nil is the empty map.
+func (e Evaluator) toMap(v expr.Expr) (expr.Map, error) {
+	switch v := v.(type) {
+	case expr.Map:
+		return v, nil
+	case expr.Nil:
+		return expr.NewMap(), nil
+	default:
+		return expr.Map{}, e.error(TypeError, v, "expect a map, got", v.ExprName())
+	}
+}
+
+func get(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 3 {
+		return nil, e.error(ArityError, values[0], "need at least 2 arguments")
+	}
+	m, err := e.toMap(values[1])
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := m.Get(values[2]); ok {
+		return v, nil
+	}
+	if len(values) > 3 {
+		return values[3], nil
+	}
+	return expr.NewNil(), nil
+}
+
+func assoc(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 4 || len(values)%2 != 0 {
+		return nil, e.error(ArityError, values[0], "need a map and key value pairs")
+	}
+	m, err := e.toMap(values[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkListSize(m.Len()+(len(values)-2)/2, values[0]); err != nil {
+		return nil, err
+	}
+	for i := 2; i < len(values); i += 2 {
+		m = m.Assoc(values[i], values[i+1])
+	}
+	return m, nil
+}
+
+func dissoc(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 {
+		return nil, e.error(ArityError, values[0], "need at least 1 argument")
+	}
+	m, err := e.toMap(values[1])
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range values[2:] {
+		m = m.Dissoc(k)
+	}
+	return m, nil
+}
+
+func keys(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 {
+		return nil, e.error(ArityError, values[0], "need 1 argument")
+	}
+	m, err := e.toMap(values[1])
+	if err != nil {
+		return nil, err
+	}
+	res := []expr.Expr{}
+	for _, entry := range m.Entries() {
+		res = append(res, entry.Key)
+	}
+	return expr.NewList(res...), nil
+}
+
+func vals(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 {
+		return nil, e.error(ArityError, values[0], "need 1 argument")
+	}
+	m, err := e.toMap(values[1])
+	if err != nil {
+		return nil, err
+	}
+	res := []expr.Expr{}
+	for _, entry := range m.Entries() {
+		res = append(res, entry.Value)
+	}
+	return expr.NewList(res...), nil
+}
+
+func contains(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 3 {
+		return nil, e.error(ArityError, values[0], "need 2 arguments")
+	}
+	m, err := e.toMap(values[1])
+	if err != nil {
+		return nil, err
+	}
+	_, ok := m.Get(values[2])
+	return expr.NewBool(ok), nil
+}
+
+func merge(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	res := expr.NewMap()
+	for _, v := range values[1:] {
+		m, err := e.toMap(v)
+		if err != nil {
+			return nil, err
+		}
+		for k, entry := range m.Value {
+			res.Value[k] = entry
+		}
+	}
+	if err := e.checkListSize(res.Len(), values[0]); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// (update m k f args...) associates k with (f (get m k) args...)
+func update(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 4 {
+		return nil, e.error(ArityError, values[0], "need at least 3 arguments")
+	}
+	m, err := e.toMap(values[1])
+	if err != nil {
+		return nil, err
+	}
+	old, ok := m.Get(values[2])
+	if !ok {
+		if err := e.checkListSize(m.Len()+1, values[0]); err != nil {
+			return nil, err
+		}
+		old = expr.NewNil()
+	}
+	args := append([]expr.Expr{old}, values[4:]...)
+	v, err := e.call(values[3], args, values[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.Assoc(values[2], v), nil
+}
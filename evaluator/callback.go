@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+// GoFunc returns the closure or builtin f as a Go function calling back into
+// this evaluator, with arguments and result converted like InvokeFunc's.
+// Like the evaluator, the function must not be called concurrently.
+func (e Evaluator) GoFunc(f expr.Expr) (func(...any) (any, error), error) {
+	switch f.(type) {
+	case expr.Closure, expr.Builtin:
+		return e.goFunc(f), nil
+	default:
+		return nil, e.error(TypeError, f, "expect a function, got", f.ExprName())
+	}
+}
+
+// BindFunc sets the function pointed to by fptr to call the closure or
+// builtin f, with arguments and results converted by the function's type like
+// RegisterFunc's:
+//
+//	var less func(a, b Item) bool
+//	err := e.BindFunc(f, &less)
+//
+// An error of a call is returned as the function's trailing error result,
+// without one it panics with the error. Like GoFunc's, the function must not
+// be called concurrently.
+func (e Evaluator) BindFunc(f expr.Expr, fptr any) error {
+	p := reflect.ValueOf(fptr)
+	if p.Kind() != reflect.Pointer || p.IsNil() || p.Elem().Kind() != reflect.Func {
+		return fmt.Errorf("BindFunc of %T, expect a pointer to a function", fptr)
+	}
+	v, err := e.fromLisp(f, p.Elem().Type())
+	if err != nil {
+		return e.error(TypeError, f, err.Error())
+	}
+	p.Elem().Set(v)
+	return nil
+}
+
+func (e Evaluator) goFunc(f expr.Expr) func(...any) (any, error) {
+	return func(args ...any) (any, error) {
+		values := make([]expr.Expr, len(args))
+		for i, a := range args {
+			values[i] = expr.LVal(a)
+		}
+		res, err := e.call(f, values, f)
+		if err != nil {
+			return nil, err
+		}
+		return e.gval(res), nil
+	}
+}
+
+// gval is expr.GVal with closures and builtins converted to Go functions.
+func (e Evaluator) gval(v expr.Expr) any {
+	return expr.GValFunc(v, func(v expr.Expr) any {
+		switch v.(type) {
+		case expr.Closure, expr.Builtin:
+			return e.goFunc(v)
+		}
+		return v
+	})
+}
+
+// makeFunc returns f as a Go function of type t, see BindFunc. Several
+// results are taken from a list returned by f.
+func (e Evaluator) makeFunc(f expr.Expr, t reflect.Type) reflect.Value {
+	outs := t.NumOut()
+	withErr := outs > 0 && t.Out(outs-1) == errorType
+	if withErr {
+		outs--
+	}
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		fail := func(err error) []reflect.Value {
+			if !withErr {
+				panic(err)
+			}
+			out[outs] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		if t.IsVariadic() {
+			rest := in[len(in)-1]
+			in = in[:len(in)-1]
+			for i := 0; i < rest.Len(); i++ {
+				in = append(in, rest.Index(i))
+			}
+		}
+		args := make([]expr.Expr, len(in))
+		for i, a := range in {
+			v, err := e.toLisp(a)
+			if err != nil {
+				return fail(e.error(TypeError, f, fmt.Sprintf("argument %d: %v", i+1, err)))
+			}
+			args[i] = v
+		}
+		res, err := e.call(f, args, f)
+		if err != nil {
+			return fail(err)
+		}
+
+		results := []expr.Expr{res}
+		if outs > 1 {
+			l, ok := res.(expr.List)
+			if !ok || len(l.Value) != outs {
+				return fail(e.error(TypeError, f, fmt.Sprintf("expect a list of %d results, got %v", outs, res)))
+			}
+			results = l.Value
+		}
+		for i := 0; i < outs; i++ {
+			v, err := e.fromLisp(results[i], t.Out(i))
+			if err != nil {
+				return fail(e.error(TypeError, f, fmt.Sprintf("result %d: %v", i+1, err)))
+			}
+			out[i] = v
+		}
+		return out
+	})
+}
@@ -0,0 +1,516 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+var (
+	exprType    = reflect.TypeOf((*expr.Expr)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+	ratType     = reflect.TypeOf((*big.Rat)(nil))
+)
+
+// ConvertError reports a value that can't be converted between GoLisp and
+// Go. Path locates it in the value converted, like items[1].qty.
+type ConvertError struct {
+	Path    string
+	Message string
+}
+
+func (e *ConvertError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+func convertErrorf(format string, args ...any) error {
+	return &ConvertError{Message: fmt.Sprintf(format, args...)}
+}
+
+// atPath prefixes the path of err with the field name or index segment.
+func atPath(err error, segment string) error {
+	ce, ok := err.(*ConvertError)
+	if !ok {
+		return err
+	}
+	switch {
+	case ce.Path == "" || strings.HasPrefix(ce.Path, "["):
+		ce.Path = segment + ce.Path
+	default:
+		ce.Path = segment + "." + ce.Path
+	}
+	return ce
+}
+
+// Decode converts the GoLisp value, or the Go value of it returned by
+// EvalString, InvokeFunc or GetGlobal, into the Go value target points to.
+// Maps decode into structs by golisp tags, or by field names ignoring case.
+// Strings decode into time.Time by RFC 3339. Functions can only be decoded
+// by Evaluator.Decode.
+func Decode(value any, target any) error {
+	return Evaluator{}.Decode(value, target)
+}
+
+// Decode is Decode, with closures and builtins decoded into functions calling
+// back into e.
+func (e Evaluator) Decode(value any, target any) error {
+	p := reflect.ValueOf(target)
+	if p.Kind() != reflect.Pointer || p.IsNil() {
+		return fmt.Errorf("Decode into %T, expect a non nil pointer", target)
+	}
+	v, err := e.fromLisp(expr.LVal(value), p.Elem().Type())
+	if err != nil {
+		return err
+	}
+	p.Elem().Set(v)
+	return nil
+}
+
+// Encode converts the Go value v into a GoLisp value, the reverse of Decode.
+// Structs encode into maps with string keys, time.Time into RFC 3339
+// strings, values without a GoLisp representation into objects.
+func Encode(v any) (expr.Expr, error) {
+	return Evaluator{}.Encode(v)
+}
+
+// Encode is Encode, with values of the types exposed on e encoded into objects.
+func (e Evaluator) Encode(v any) (expr.Expr, error) {
+	return e.toLisp(reflect.ValueOf(v))
+}
+
+// fromLisp converts v to a Go value of type t. Closures and builtins are
+// converted to functions calling back into e.
+func (e Evaluator) fromLisp(v expr.Expr, t reflect.Type) (reflect.Value, error) {
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, convertErrorf("expect %s, got %s", t, v.ExprName())
+	}
+	if t == exprType {
+		res := reflect.New(t).Elem()
+		res.Set(reflect.ValueOf(v))
+		return res, nil
+	}
+	if obj, ok := v.(expr.GoObject); ok {
+		g := reflect.ValueOf(obj.Value)
+		if !g.IsValid() || !g.Type().AssignableTo(t) {
+			return reflect.Value{}, convertErrorf("expect %s, got %s", t, obj)
+		}
+		res := reflect.New(t).Elem()
+		res.Set(g)
+		return res, nil
+	}
+	if _, ok := v.(expr.Nil); ok {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	if t == timeType {
+		s, ok := v.(expr.String)
+		if !ok {
+			return mismatch()
+		}
+		tm, err := time.Parse(time.RFC3339Nano, s.Value)
+		if err != nil {
+			return reflect.Value{}, convertErrorf("expect an RFC 3339 time, got %q", s.Value)
+		}
+		return reflect.ValueOf(tm), nil
+	}
+	if t == bigIntType || t == ratType {
+		n, ok := toNum(v)
+		if !ok {
+			return mismatch()
+		}
+		r := n.rat()
+		if t == ratType && r != nil {
+			return reflect.ValueOf(new(big.Rat).Set(r)), nil
+		}
+		if t == bigIntType && r != nil && r.IsInt() {
+			return reflect.ValueOf(new(big.Int).Set(r.Num())), nil
+		}
+		return reflect.Value{}, convertErrorf("expect %s, got %v", t, v)
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if reflect.TypeOf(v).Implements(t) && t.NumMethod() > 0 {
+			res := reflect.New(t).Elem()
+			res.Set(reflect.ValueOf(v))
+			return res, nil
+		}
+		g := reflect.ValueOf(e.gval(v))
+		if !g.Type().Implements(t) {
+			return mismatch()
+		}
+		res := reflect.New(t).Elem()
+		res.Set(g)
+		return res, nil
+
+	case reflect.Bool:
+		b, ok := v.(expr.Bool)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(b.Value).Convert(t), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := v.(type) {
+		case expr.Int:
+			i = n.Value
+		case expr.Float:
+			if n.Value != math.Trunc(n.Value) || n.Value < math.MinInt64 || n.Value >= math.MaxInt64 {
+				return reflect.Value{}, convertErrorf("expect %s, got %v", t, n)
+			}
+			i = int64(n.Value)
+		case expr.BigInt, expr.Decimal:
+			x, _ := toNum(n)
+			r := x.rat()
+			if !r.IsInt() {
+				return reflect.Value{}, convertErrorf("expect %s, got %v", t, n)
+			}
+			if !r.Num().IsInt64() {
+				return reflect.Value{}, convertErrorf("%v overflows %s", v, t)
+			}
+			i = r.Num().Int64()
+		default:
+			return mismatch()
+		}
+		res := reflect.New(t).Elem()
+		if res.OverflowInt(i) {
+			return reflect.Value{}, convertErrorf("%v overflows %s", v, t)
+		}
+		res.SetInt(i)
+		return res, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := v.(type) {
+		case expr.Int:
+			if n.Value < 0 {
+				return reflect.Value{}, convertErrorf("expect %s, got %v", t, n)
+			}
+			u = uint64(n.Value)
+		case expr.Float:
+			if n.Value != math.Trunc(n.Value) || n.Value < 0 || n.Value >= math.MaxUint64 {
+				return reflect.Value{}, convertErrorf("expect %s, got %v", t, n)
+			}
+			u = uint64(n.Value)
+		case expr.BigInt, expr.Decimal:
+			x, _ := toNum(n)
+			r := x.rat()
+			if !r.IsInt() || r.Sign() < 0 {
+				return reflect.Value{}, convertErrorf("expect %s, got %v", t, n)
+			}
+			if !r.Num().IsUint64() {
+				return reflect.Value{}, convertErrorf("%v overflows %s", v, t)
+			}
+			u = r.Num().Uint64()
+		default:
+			return mismatch()
+		}
+		res := reflect.New(t).Elem()
+		if res.OverflowUint(u) {
+			return reflect.Value{}, convertErrorf("%v overflows %s", v, t)
+		}
+		res.SetUint(u)
+		return res, nil
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := toNum(v)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(n.float()).Convert(t), nil
+
+	case reflect.String:
+		switch s := v.(type) {
+		case expr.String:
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		case expr.Symbol:
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+		return mismatch()
+
+	case reflect.Slice, reflect.Array:
+		var items []expr.Expr
+		switch s := v.(type) {
+		case expr.List:
+			items = s.Value
+		case expr.Vector:
+			items = s.Value
+		default:
+			return mismatch()
+		}
+		var res reflect.Value
+		if t.Kind() == reflect.Slice {
+			res = reflect.MakeSlice(t, len(items), len(items))
+		} else {
+			if len(items) != t.Len() {
+				return reflect.Value{}, convertErrorf("expect %d elements for %s, got %d", t.Len(), t, len(items))
+			}
+			res = reflect.New(t).Elem()
+		}
+		for i, item := range items {
+			elem, err := e.fromLisp(item, t.Elem())
+			if err != nil {
+				return reflect.Value{}, atPath(err, fmt.Sprintf("[%d]", i))
+			}
+			res.Index(i).Set(elem)
+		}
+		return res, nil
+
+	case reflect.Map:
+		m, ok := v.(expr.Map)
+		if !ok {
+			return mismatch()
+		}
+		res := reflect.MakeMapWithSize(t, m.Len())
+		for _, entry := range m.Entries() {
+			key, err := e.fromLisp(entry.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, atPath(err, "["+entry.Key.String()+"]")
+			}
+			value, err := e.fromLisp(entry.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, atPath(err, "["+entry.Key.String()+"]")
+			}
+			res.SetMapIndex(key, value)
+		}
+		return res, nil
+
+	case reflect.Struct:
+		m, ok := v.(expr.Map)
+		if !ok {
+			return mismatch()
+		}
+		res := reflect.New(t).Elem()
+		for _, entry := range m.Entries() {
+			name, ok := keyName(entry.Key)
+			if !ok {
+				return reflect.Value{}, convertErrorf("expect a string or symbol key for %s, got %v", t, entry.Key)
+			}
+			field, ok := fieldByName(t, name)
+			if !ok {
+				return reflect.Value{}, atPath(convertErrorf("unknown field of %s", t), name)
+			}
+			value, err := e.fromLisp(entry.Value, field.Type)
+			if err != nil {
+				return reflect.Value{}, atPath(err, name)
+			}
+			res.FieldByIndex(field.Index).Set(value)
+		}
+		return res, nil
+
+	case reflect.Func:
+		switch v.(type) {
+		case expr.Closure, expr.Builtin:
+			if e.builtins == nil {
+				return reflect.Value{}, convertErrorf("functions are decoded by Evaluator.Decode only")
+			}
+			return e.makeFunc(v, t), nil
+		}
+		return mismatch()
+
+	case reflect.Pointer:
+		elem, err := e.fromLisp(v, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res := reflect.New(t.Elem())
+		res.Elem().Set(elem)
+		return res, nil
+
+	default:
+		return mismatch()
+	}
+}
+
+// keyName returns the name a map key stands for as a struct field.
+func keyName(k expr.Expr) (string, bool) {
+	switch k := k.(type) {
+	case expr.String:
+		return k.Value, true
+	case expr.Symbol:
+		return k.Value, true
+	}
+	return "", false
+}
+
+// fieldByName finds the exported field of t with the key name, its golisp
+// tag or else its name ignoring case. Fields tagged "-" have no key.
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _ := fieldKey(f)
+		if key == "" {
+			continue
+		}
+		if _, tagged := f.Tag.Lookup("golisp"); tagged && key == name || !tagged && strings.EqualFold(key, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// fieldKey returns the key of f in a GoLisp map, set by a tag like
+// `golisp:"discount-rate,omitempty"`, or "" if the tag is "-".
+func fieldKey(f reflect.StructField) (key string, omitEmpty bool) {
+	tag, ok := f.Tag.Lookup("golisp")
+	if !ok {
+		return f.Name, false
+	}
+	if tag == "-" {
+		return "", false
+	}
+	key, opts, _ := strings.Cut(tag, ",")
+	if key == "" {
+		key = f.Name
+	}
+	return key, opts == "omitempty"
+}
+
+// visit is a pointer, map or slice toLisp is converting, a value reached
+// again through it is a cycle.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// toLisp converts the Go value v to a GoLisp value. Values of exposed types
+// and values without a GoLisp representation are passed as a GoObject.
+func (e Evaluator) toLisp(v reflect.Value) (expr.Expr, error) {
+	return e.encode(v, map[visit]bool{})
+}
+
+// encode is toLisp, with the pointers, maps and slices being converted in
+// visiting. Values shared without a cycle are converted each time reached.
+func (e Evaluator) encode(v reflect.Value, visiting map[visit]bool) (expr.Expr, error) {
+	if !v.IsValid() {
+		return expr.NewNil(), nil
+	}
+	if v.Type() == timeType {
+		return expr.NewString(v.Interface().(time.Time).Format(time.RFC3339Nano)), nil
+	}
+	if _, ok := e.objects[v.Type()]; ok {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return expr.NewNil(), nil
+		}
+		return expr.NewGoObject(v.Interface()), nil
+	}
+	if v.Type().Implements(exprType) {
+		if v.Kind() == reflect.Interface && v.IsNil() {
+			return expr.NewNil(), nil
+		}
+		return v.Interface().(expr.Expr), nil
+	}
+	if v.Type() == bigIntType || v.Type() == ratType {
+		return expr.LVal(v.Interface()), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			at := visit{v.Pointer(), v.Type(), 0}
+			if v.Kind() == reflect.Slice {
+				at.len = v.Len()
+			}
+			if visiting[at] {
+				return nil, convertErrorf("cycle through %s", v.Type())
+			}
+			visiting[at] = true
+			defer delete(visiting, at)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return expr.NewBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return expr.NewInt(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return expr.LVal(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return expr.NewFloat(v.Float()), nil
+	case reflect.String:
+		return expr.NewString(v.String()), nil
+
+	case reflect.Slice, reflect.Array:
+		res := make([]expr.Expr, v.Len())
+		for i := range res {
+			item, err := e.encode(v.Index(i), visiting)
+			if err != nil {
+				return nil, atPath(err, fmt.Sprintf("[%d]", i))
+			}
+			res[i] = item
+		}
+		return expr.NewList(res...), nil
+
+	case reflect.Map:
+		res := expr.NewMap()
+		iter := v.MapRange()
+		for iter.Next() {
+			var key expr.Expr
+			if iter.Key().Kind() == reflect.String {
+				key = expr.NewString(iter.Key().String())
+			} else {
+				k, err := e.encode(iter.Key(), visiting)
+				if err != nil {
+					return nil, atPath(err, fmt.Sprintf("[%v]", iter.Key()))
+				}
+				key = k
+			}
+			value, err := e.encode(iter.Value(), visiting)
+			if err != nil {
+				return nil, atPath(err, "["+key.String()+"]")
+			}
+			res.Value[expr.KeyOf(key)] = expr.MapEntry{Key: key, Value: value}
+		}
+		return res, nil
+
+	case reflect.Struct:
+		res := expr.NewMap()
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, omitEmpty := fieldKey(f)
+			if name == "" || omitEmpty && v.Field(i).IsZero() {
+				continue
+			}
+			value, err := e.encode(v.Field(i), visiting)
+			if err != nil {
+				return nil, atPath(err, name)
+			}
+			key := expr.NewString(name)
+			res.Value[expr.KeyOf(key)] = expr.MapEntry{Key: key, Value: value}
+		}
+		return res, nil
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return expr.NewNil(), nil
+		}
+		return e.encode(v.Elem(), visiting)
+
+	default:
+		return expr.NewGoObject(v.Interface()), nil
+	}
+}
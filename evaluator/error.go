@@ -0,0 +1,289 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/guiyuanju/golisp/expr"
+	"github.com/guiyuanju/golisp/parser"
+)
+
+type ErrorKind int
+
+const (
+	SyntaxError ErrorKind = iota
+	NameError
+	TypeError
+	ArityError
+	IndexError
+	HostError
+	LimitError
+	RuntimeError
+	ArithmeticError // integer overflow or division by zero
+	ThrownError     // thrown by throw, or returned as an expr.Error by a Go function
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case SyntaxError:
+		return "syntax error"
+	case NameError:
+		return "name error"
+	case TypeError:
+		return "type error"
+	case ArityError:
+		return "arity error"
+	case IndexError:
+		return "index error"
+	case HostError:
+		return "host error"
+	case LimitError:
+		return "limit error"
+	case ArithmeticError:
+		return "arithmetic error"
+	case ThrownError:
+		return "error"
+	default:
+		return "runtime error"
+	}
+}
+
+// Frame is one function call or macro expansion on the call stack of an
+// Error, at the position of its call site. Calls is the number of consecutive
+// tail calls from the same site it stands for, Elided the number of tail
+// calls left out of the stack after it.
+type Frame struct {
+	Name  string
+	Macro bool
+	parser.Position
+	Calls  int
+	Elided int
+}
+
+func (f Frame) String() string {
+	var sb strings.Builder
+	if f.Macro {
+		sb.WriteString("macro ")
+	}
+	fmt.Fprintf(&sb, "%s (%v)", f.Name, f.Position)
+	if f.Calls > 1 {
+		fmt.Fprintf(&sb, " x%d", f.Calls)
+	}
+	if f.Elided > 0 {
+		fmt.Fprintf(&sb, "\n\t... %d more calls", f.Elided)
+	}
+	return sb.String()
+}
+
+// Error is returned by Eval, EvalString and InvokeFunc when evaluation fails.
+// Its position is the source range of Expr, Stack lists the calls leading to
+// the error, innermost first.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	parser.Position
+	Expr      expr.Expr
+	Expansion *Frame // the macro expansion Expr comes from, if any
+	Stack     []Frame
+	Data      expr.Expr // payload of a thrown error
+	Err       error     // underlying cause, e.g. the error returned by a Go function
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v: %s: %s", e.Position, e.Kind, e.Message)
+	if e.Expr != nil {
+		fmt.Fprintf(&sb, ", at %v", e.Expr)
+	}
+	if f := e.Expansion; f != nil {
+		fmt.Fprintf(&sb, ", expanded from macro %s at %v", f.Name, f.Position)
+	}
+	for _, f := range e.Stack {
+		fmt.Fprintf(&sb, "\n\tin %v", f)
+	}
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e Evaluator) error(kind ErrorKind, ex expr.Expr, info ...string) *Error {
+	err := &Error{
+		Kind:    kind,
+		Message: strings.Join(info, " "),
+		Expr:    ex,
+	}
+	if ex == nil {
+		return err
+	}
+	pos, from := e.locate(ex)
+	if pos == (parser.Position{}) && e.builtin.form != nil {
+		// a value given to a builtin is reported at the form it was
+		// evaluated from, the builtin itself at the call
+		ex = e.builtin.site(ex)
+		if _, ok := err.Expr.(expr.Builtin); ok {
+			err.Expr = ex
+		}
+		pos, from = e.locate(ex)
+	}
+	err.Position = pos
+	err.Expansion = from
+	return err
+}
+
+// builtinCall is the call of a builtin from the form, values are its
+// evaluated operator and arguments.
+type builtinCall struct {
+	form   expr.Expr
+	values []expr.Expr
+}
+
+// calling returns e for the builtin called from form with values.
+func (e Evaluator) calling(form expr.Expr, values []expr.Expr) Evaluator {
+	e.builtin = builtinCall{form, values}
+	return e
+}
+
+// site returns the form v was evaluated from in the call, or the call.
+func (c builtinCall) site(v expr.Expr) expr.Expr {
+	form, ok := c.form.(expr.List)
+	if !ok {
+		return c.form
+	}
+	for i, value := range c.values {
+		if i > 0 && i < len(form.Value) && value.ExprId() == v.ExprId() {
+			return form.Value[i]
+		}
+	}
+	return form
+}
+
+// value returns err as an error value for catch.
+func (err *Error) value() expr.Error {
+	v := expr.NewError(err.Message, err.Data)
+	v.Kind = err.Kind.String()
+	v.File, v.Line, v.Column = err.File, err.Line, err.Column
+	return v
+}
+
+// kindOf returns the kind named name, see ErrorKind.String.
+func kindOf(name string) ErrorKind {
+	for k := SyntaxError; k <= ThrownError; k++ {
+		if k.String() == name {
+			return k
+		}
+	}
+	return ThrownError
+}
+
+// hostError converts an error returned by a Go function, an expr.Error is
+// thrown with its data.
+func (e Evaluator) hostError(err error, ex expr.Expr) *Error {
+	var v expr.Error
+	if errors.As(err, &v) {
+		le := e.error(ThrownError, ex, v.Message)
+		le.Data = v.Data
+		le.Err = err
+		return le
+	}
+	le := e.error(HostError, ex, err.Error())
+	le.Err = err
+	return le
+}
+
+// fromSyntaxError converts an error reported by the parser package.
+func fromSyntaxError(err error) *Error {
+	var pe *parser.Error
+	if !errors.As(err, &pe) {
+		return &Error{Kind: SyntaxError, Message: err.Error(), Err: err}
+	}
+	return &Error{
+		Kind:     SyntaxError,
+		Message:  pe.Message,
+		Position: parser.Position{File: pe.File, Line: pe.Line, Column: pe.Column},
+		Err:      err,
+	}
+}
+
+// withFrame records a call to name at the call site ex on the error's stack.
+func (e Evaluator) withFrame(err error, name string, ex expr.Expr) error {
+	var le *Error
+	if !errors.As(err, &le) {
+		return err
+	}
+	le.addFrame(e.frame(name, ex))
+	return err
+}
+
+// maxStackFrames bounds the frames of an error's stack, the outermost calls
+// are left out beyond it.
+const maxStackFrames = 64
+
+// addFrame adds f as the outermost frame of the stack. A recursive call from
+// the same site as the previous frame shares it.
+func (err *Error) addFrame(f Frame) {
+	if n := len(err.Stack); n > 0 {
+		last := &err.Stack[n-1]
+		switch {
+		case last.Elided == 0 && last.Name == f.Name && last.Macro == f.Macro && last.Position == f.Position:
+			last.Calls += f.Calls
+			last.Elided = f.Elided
+			return
+		case n == maxStackFrames:
+			last.Elided += f.Calls + f.Elided
+			return
+		}
+	}
+	err.Stack = append(err.Stack, f)
+}
+
+func (e Evaluator) frame(name string, site expr.Expr) Frame {
+	pos, ok := e.Positions[site.ExprId()]
+	if !ok {
+		pos, _ = e.locate(site)
+	}
+	return Frame{Name: name, Position: pos, Calls: 1}
+}
+
+// maxTailFrames bounds the frames kept for the tail calls of one Eval loop,
+// the oldest are left out beyond it.
+const maxTailFrames = 32
+
+// tailFrames records the calls and macro expansions an Eval loop continued
+// into, whose Go frames are gone, so that errors still show them. Consecutive
+// calls from the same site, like the iterations of a tail recursive loop,
+// share a frame.
+type tailFrames struct {
+	frames []Frame // oldest first
+	sites  []int   // ids of the call sites of frames
+	elided int
+}
+
+func (t *tailFrames) push(f Frame, site expr.Expr) {
+	if n := len(t.frames); n > 0 && t.sites[n-1] == site.ExprId() && t.frames[n-1].Name == f.Name {
+		t.frames[n-1].Calls++
+		return
+	}
+	if len(t.frames) == maxTailFrames {
+		t.elided += t.frames[0].Calls
+		t.frames = append(t.frames[:0], t.frames[1:]...)
+		t.sites = append(t.sites[:0], t.sites[1:]...)
+	}
+	t.frames = append(t.frames, f)
+	t.sites = append(t.sites, site.ExprId())
+}
+
+// annotate adds the recorded frames to the stack of err, innermost first.
+func (t *tailFrames) annotate(err error) error {
+	var le *Error
+	if len(t.frames) == 0 || !errors.As(err, &le) {
+		return err
+	}
+	for i := len(t.frames) - 1; i >= 0; i-- {
+		le.addFrame(t.frames[i])
+	}
+	le.Stack[len(le.Stack)-1].Elided += t.elided
+	return err
+}
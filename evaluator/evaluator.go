@@ -1,11 +1,9 @@
 package evaluator
 
 import (
-	"errors"
-	"fmt"
 	"os"
+	"reflect"
 	"strconv"
-	"strings"
 
 	"github.com/guiyuanju/golisp/expr"
 	"github.com/guiyuanju/golisp/parser"
@@ -13,22 +11,62 @@ import (
 )
 
 type Evaluator struct {
+	// the builtins and the prelude in the first layer, the globals of the
+	// scripts in the second, modules are rooted at the first only
 	env       expr.Env
 	Positions parser.Positions
 	builtins  Builtins
+	modules   *loader
+	module    *module                   // the module being loaded, nil at top level
+	objects   map[reflect.Type]exposure // Go types scripts may access, see Expose
+	run       *run                      // nil unless evaluating under limits
+	warn      *func(w *Error)           // reports warnings, see OnWarning
+	builtin   builtinCall               // the builtin being called, see Evaluator.error
+	expansion *expansion                // the macro expansion being evaluated, see locate
+	step      *stepLayer                // the layer of the innermost loop in scope, see stepLayer
 }
 
+// New returns an evaluator with the core builtins and the default layer
+// registered by RegisterBuiltin.
 func New() Evaluator {
-	env := expr.NewEnv()
-	RegisterDefaultBuiltins()
-	for name, _ := range RegisteredBuiltins {
-		env.Add(name, expr.NewBuiltin(name))
+	return NewWith(GlobalBuiltins())
+}
+
+// NewWith returns an evaluator with the core builtins and the given sets,
+// later sets override earlier ones. The sets are copied, registering on the
+// evaluator afterwards doesn't change them.
+func NewWith(sets ...Builtins) Evaluator {
+	e := Evaluator{
+		env:       expr.NewEnv().AppendEnv(expr.NewEnv()),
+		Positions: parser.NewPositions(),
+		builtins:  Builtins{},
+		modules:   newLoader(),
+		objects:   map[reflect.Type]exposure{},
+		warn:      new(func(w *Error)),
 	}
-	return Evaluator{env, parser.NewPositions(), RegisteredBuiltins}
+	for name, proc := range Compose(append([]Builtins{DefaultBuiltins()}, sets...)...) {
+		e.RegisterProc(name, proc)
+	}
+	return e
 }
 
-func (e Evaluator) errorInfo(file string, expr expr.Expr, info ...string) string {
-	return fmt.Sprintf("%s:%d:%d: %v (%s) %s", file, e.Positions[expr.ExprId()].Line, e.Positions[expr.ExprId()].Column, expr, fmt.Sprintf("%T", expr), strings.Join(info, " "))
+// Register makes f callable by name from scripts run by this evaluator only.
+func (e Evaluator) Register(name string, f func(...any) (any, error)) {
+	e.RegisterProc(name, hostProc(f))
+}
+
+// RegisterProc makes proc callable by name from scripts run by this evaluator only.
+func (e Evaluator) RegisterProc(name string, proc Proc) {
+	e.builtins[name] = proc
+	e.env[0][name] = expr.NewBuiltin(name)
+}
+
+// Unregister removes the builtin name from this evaluator.
+func (e Evaluator) Unregister(name string) {
+	delete(e.builtins, name)
+	if v, ok := e.env[0][name].(expr.Builtin); ok && v.Name == name {
+		delete(e.env[0], name)
+	}
 }
 
 func isSpecialForm(e expr.List) bool {
@@ -40,218 +78,215 @@ func isSpecialForm(e expr.List) bool {
 		return false
 	}
 	switch s.Value {
-	case expr.SF_QUOTE, expr.SF_VAR, expr.SF_SET, expr.SF_IF, expr.SF_FN, expr.SF_MACRO, expr.SF_APPLY:
+	case expr.SF_QUOTE, expr.SF_VAR, expr.SF_SET, expr.SF_IF, expr.SF_FN, expr.SF_MACRO, expr.SF_APPLY,
+		expr.SF_QUASIQUOTE, expr.SF_UNQUOTE, expr.SF_UNQUOTE_SPLICING, expr.SF_SYNTAX_RULES,
+		expr.SF_MODULE, expr.SF_IMPORT, expr.SF_THROW, expr.SF_TRY, expr.SF_MATCH,
+		expr.SF_LOOP, expr.SF_RECUR, expr.SF_WHILE, expr.SF_DOTIMES, expr.SF_FOR_EACH:
 		return true
 	default:
 		return false
 	}
 }
 
-func (evaluator Evaluator) evalSpecialForm(e expr.List) (expr.Expr, bool) {
+// evalSpecialForm evaluates the special form e. Forms whose value is the value
+// of a subexpression in tail position return that subexpression as next instead
+// of evaluating it, so that Eval can continue with it in constant Go stack.
+func (evaluator Evaluator) evalSpecialForm(e expr.List) (value expr.Expr, next expr.Expr, err error) {
 	s := e.Value[0].(expr.Symbol)
 	switch s.Value {
 	case expr.SF_QUOTE:
 		if len(e.Value) != 2 {
-			fmt.Println(evaluator.errorInfo("repl", s, "expect 1 argument"))
-			return nil, false
+			return nil, nil, evaluator.error(ArityError, s, "expect 1 argument")
 		}
-		return e.Value[1], true
+		return e.Value[1], nil, nil
+
+	case expr.SF_QUASIQUOTE:
+		if len(e.Value) != 2 {
+			return nil, nil, evaluator.error(ArityError, s, "expect 1 argument")
+		}
+		value, err := evaluator.quasiquote(e.Value[1], 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return value, nil, nil
+
+	case expr.SF_UNQUOTE, expr.SF_UNQUOTE_SPLICING:
+		return nil, nil, evaluator.error(RuntimeError, s, s.Value, "outside of quasiquote")
 
 	case expr.SF_VAR:
 		if len(e.Value) < 3 {
-			fmt.Println(evaluator.errorInfo("repl", s, "expect 2 arguments"))
-			return nil, false
+			return nil, nil, evaluator.error(ArityError, s, "expect 2 arguments")
+		}
+		if isPattern(e.Value[1]) {
+			if err := evaluator.checkPattern(e.Value[1], map[string]bool{}); err != nil {
+				return nil, nil, err
+			}
+			value, err := evaluator.Eval(e.Value[2])
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := evaluator.destructure(e.Value[1], value); err != nil {
+				return nil, nil, err
+			}
+			return expr.NewNil(), nil, nil
 		}
 		name, ok := e.Value[1].(expr.Symbol)
 		if !ok {
-			fmt.Println(evaluator.errorInfo("repl", name, "expect symbol"))
-			return nil, false
+			return nil, nil, evaluator.error(TypeError, e.Value[1], "expect symbol")
 		}
-		value, ok := evaluator.Eval(e.Value[2])
-		if !ok {
-			return nil, false
+		value, err := evaluator.Eval(e.Value[2])
+		if err != nil {
+			return nil, nil, err
 		}
 		if !evaluator.env.Add(name.Value, value) {
-			fmt.Println(evaluator.errorInfo("repl", name, "already defined:", name.Value))
-			return nil, false
+			return nil, nil, evaluator.error(NameError, name, "already defined:", name.Value)
 		}
-		return expr.NewNil(), true
+		return expr.NewNil(), nil, nil
 
 	case expr.SF_SET:
 		if len(e.Value) < 3 {
-			fmt.Println(evaluator.errorInfo("repl", s, "expect 2 arguments"))
-			return nil, false
+			return nil, nil, evaluator.error(ArityError, s, "expect 2 arguments")
 		}
 		name, ok := e.Value[1].(expr.Symbol)
 		if !ok {
-			fmt.Println(evaluator.errorInfo("repl", name, "expect symbol"))
-			return nil, false
+			return nil, nil, evaluator.error(TypeError, e.Value[1], "expect symbol")
 		}
-		value, ok := evaluator.Eval(e.Value[2])
-		if !ok {
-			return nil, false
+		value, err := evaluator.Eval(e.Value[2])
+		if err != nil {
+			return nil, nil, err
 		}
 		if !evaluator.env.Set(name.Value, value) {
-			fmt.Println(evaluator.errorInfo("repl", name, "already defined:", name.Value))
-			return nil, false
+			return nil, nil, evaluator.error(NameError, name, "undefined:", name.Value)
 		}
-		return expr.NewNil(), true
+		return expr.NewNil(), nil, nil
 
 	case expr.SF_IF:
 		if len(e.Value) < 3 {
-			fmt.Println(evaluator.errorInfo("repl", s, "expect at least two arguments"))
-			return nil, false
+			return nil, nil, evaluator.error(ArityError, s, "expect at least two arguments")
 		}
-		pred, ok := evaluator.Eval(e.Value[1])
-		if !ok {
-			return nil, false
+		pred, err := evaluator.Eval(e.Value[1])
+		if err != nil {
+			return nil, nil, err
 		}
 		if isTruthy(pred) {
-			return evaluator.Eval(e.Value[2])
+			return nil, e.Value[2], nil
 		}
 		if len(e.Value) < 4 {
-			return expr.NewNil(), true
+			return expr.NewNil(), nil, nil
 		}
-		return evaluator.Eval(e.Value[3])
+		return nil, e.Value[3], nil
 
 	case expr.SF_FN:
 		if len(e.Value) < 3 {
-			fmt.Println(evaluator.errorInfo("repl", s, "expect an argument list and a body"))
-			return nil, false
+			return nil, nil, evaluator.error(ArityError, s, "expect an argument list and a body")
 		}
 		switch first := e.Value[1].(type) {
-		case expr.List:
-			params := []string{}
-			body := []expr.Expr{}
-			var i int
-			for ; i < len(first.Value); i++ {
-				p, ok := first.Value[i].(expr.Symbol)
-				if !ok {
-					fmt.Println(evaluator.errorInfo("repl", p, "expect a symbol"))
-					return nil, false
-				}
-				if p.Value == "&" {
-					break
-				}
-				params = append(params, p.Value)
-			}
-			// varparam
-			var varparam string
-			if i < len(first.Value) {
-				if i == len(first.Value)-1 {
-					fmt.Println(evaluator.errorInfo("repl", first.Value[i], "expect a symbol after &"))
-					return nil, false
-				}
-				v, ok := first.Value[i+1].(expr.Symbol)
-				if !ok {
-					fmt.Println(evaluator.errorInfo("repl", first.Value[i+1], "expect a symbol"))
-					return nil, false
-				}
-				varparam = v.Value
+		case expr.List, expr.Vector:
+			params, varparam, patterns, err := evaluator.params(first)
+			if err != nil {
+				return nil, nil, err
 			}
-
-			body = e.Value[2:]
-			// check param name duplication
-			exist := map[string]bool{}
-			for _, param := range params {
-				if exist[param] {
-					fmt.Println(evaluator.errorInfo("repl", e, "parameter name must be unique"))
-					return nil, false
-				}
-				exist[param] = true
-			}
-
-			closure := expr.NewClosure(evaluator.env, params, varparam, body)
-			return closure, true
+			closure := expr.NewClosure(evaluator.env, params, varparam, e.Value[2:])
+			closure.Patterns = patterns
+			evaluator.step.capture()
+			return closure, nil, nil
 		case expr.Symbol:
 			name := first.Value
 			if len(e.Value) < 4 {
-				fmt.Println(evaluator.errorInfo("repl", s, "expect an argument list and body"))
-				return nil, false
+				return nil, nil, evaluator.error(ArityError, s, "expect an argument list and body")
 			}
 			// redispatch to (var (fn [...] ...))
 			newFn := []expr.Expr{e.Value[0]}
 			newFn = append(newFn, e.Value[2:]...)
 			newVar := expr.NewList(expr.NewSymbol(expr.SF_VAR), expr.NewSymbol(name), expr.NewList(newFn...))
-			return evaluator.Eval(newVar)
+			return nil, newVar, nil
 		default:
-			fmt.Println(evaluator.errorInfo("repl", e.Value[1], "expect a symbol or an argument list"))
-			return nil, false
+			return nil, nil, evaluator.error(TypeError, e.Value[1], "expect a symbol or an argument list")
 		}
 
 	case expr.SF_MACRO:
 		if len(e.Value) < 4 {
-			fmt.Println(evaluator.errorInfo("repl", e, "expect a symbol, a argument list and body"))
-			return nil, false
+			return nil, nil, evaluator.error(ArityError, e, "expect a symbol, a argument list and body")
 		}
 		name, ok := e.Value[1].(expr.Symbol)
 		if !ok {
-			fmt.Println(evaluator.errorInfo("repl", e.Value[1], "expect a symbol"))
-			return nil, false
-		}
-		args, ok := e.Value[2].(expr.List)
-		if !ok {
-			fmt.Println(evaluator.errorInfo("repl", e.Value[2], "expect a argument list"))
-			return nil, false
-		}
-		params := []string{}
-		var i int
-		for ; i < len(args.Value); i++ {
-			p, ok := args.Value[i].(expr.Symbol)
-			if !ok {
-				fmt.Println(evaluator.errorInfo("repl", args.Value[i], "expect a symbol"))
-				return nil, false
-			}
-			if p.Value == "&" {
-				break
-			}
-			params = append(params, p.Value)
+			return nil, nil, evaluator.error(TypeError, e.Value[1], "expect a symbol")
 		}
-		var varparam string
-		if i < len(args.Value) {
-			if i == len(args.Value)-1 {
-				fmt.Println(evaluator.errorInfo("repl", args.Value[i], "expect a symbol after &"))
-				return nil, false
-			}
-			v, ok := args.Value[i+1].(expr.Symbol)
-			if !ok {
-				fmt.Println(evaluator.errorInfo("repl", v, "expect a symbol"))
-				return nil, false
-			}
-			varparam = v.Value
+		params, varparam, patterns, err := evaluator.params(e.Value[2])
+		if err != nil {
+			return nil, nil, err
 		}
 		body := e.Value[3:]
 		closure := expr.NewClosure(evaluator.env, params, varparam, body)
+		closure.Patterns = patterns
+		evaluator.step.capture()
 		macro := expr.NewMacro(name.Value, closure)
 		if !evaluator.env.Add(name.Value, macro) {
-			fmt.Println(evaluator.errorInfo("repl", name, "already defined"))
-			return nil, false
+			return nil, nil, evaluator.error(NameError, name, "already defined:", name.Value)
 		}
-		return expr.NewNil(), true
+		return expr.NewNil(), nil, nil
+
+	case expr.SF_SYNTAX_RULES:
+		if err := evaluator.defineSyntaxRules(e); err != nil {
+			return nil, nil, err
+		}
+		return expr.NewNil(), nil, nil
+
+	case expr.SF_MODULE:
+		if err := evaluator.defineModule(e); err != nil {
+			return nil, nil, err
+		}
+		return expr.NewNil(), nil, nil
+
+	case expr.SF_IMPORT:
+		mod, err := evaluator.importModule(e)
+		return mod, nil, err
+
+	case expr.SF_THROW:
+		return nil, nil, evaluator.throw(e)
+
+	case expr.SF_TRY:
+		value, err := evaluator.evalTry(e)
+		return value, nil, err
+
+	case expr.SF_WHILE:
+		value, err := evaluator.evalWhile(e)
+		return value, nil, err
+
+	case expr.SF_DOTIMES:
+		value, err := evaluator.evalDotimes(e)
+		return value, nil, err
+
+	case expr.SF_FOR_EACH:
+		value, err := evaluator.evalForEach(e)
+		return value, nil, err
 
 	case expr.SF_APPLY:
 		if len(e.Value)-1 < 2 {
-			fmt.Println(evaluator.errorInfo("repl", e.Value[0], "need at least 2 arguments"))
-			return nil, false
+			return nil, nil, evaluator.error(ArityError, e.Value[0], "need at least 2 arguments")
 		}
-		rest, ok := evaluator.Eval(e.Value[2])
-		if !ok {
-			return nil, false
+		rest, err := evaluator.Eval(e.Value[2])
+		if err != nil {
+			return nil, nil, err
 		}
-		restList, ok := rest.(expr.List)
-		if !ok {
-			fmt.Println(evaluator.errorInfo("repl", e.Value[2], "expect a list"))
-			return nil, false
+		var args []expr.Expr
+		switch rest := rest.(type) {
+		case expr.List:
+			args = rest.Value
+		case expr.Vector:
+			args = rest.Value
+		default:
+			return nil, nil, evaluator.error(TypeError, e.Value[2], "expect a list or vector")
 		}
 		switch f := e.Value[1].(type) {
 		case expr.List:
-			f.Append(restList)
-			f.Value = append(f.Value, restList.Value...)
-			return evaluator.Eval(f)
+			f.Value = append(f.Value[:len(f.Value):len(f.Value)], args...)
+			return nil, f, nil
 		default:
-			v := []expr.Expr{f}
-			v = append(v, restList.Value...)
-			return evaluator.Eval(expr.NewList(v...))
+			// the call keeps the id, and so the position, of the apply form
+			call := expr.NewList(append([]expr.Expr{f}, args...)...)
+			call.Id = e.Id
+			return nil, call, nil
 		}
 
 	default:
@@ -264,7 +299,7 @@ func (evaluator Evaluator) isMacro(e expr.Expr) bool {
 	if !ok {
 		return false
 	}
-	value, ok := evaluator.env.Get(symbol.Value)
+	value, ok := evaluator.lookup(symbol.Value)
 	if !ok {
 		return false
 	}
@@ -272,145 +307,426 @@ func (evaluator Evaluator) isMacro(e expr.Expr) bool {
 	return ok
 }
 
-func (evaluator Evaluator) macroExpand(e expr.List) (expr.Expr, bool) {
-	value, _ := evaluator.env.Get(e.Value[0].(expr.Symbol).Value)
+func (evaluator Evaluator) macroExpand(e expr.List) (expr.Expr, error) {
+	value, _ := evaluator.lookup(e.Value[0].(expr.Symbol).Value)
 	macro := value.(expr.Macro)
-
-	args := e.Value[1:]
-
-	if len(e.Value)-1 < len(macro.Closure.Params) {
-		fmt.Println(evaluator.errorInfo("repl", macro, "expect at least", strconv.Itoa(len(macro.Closure.Params)), "arguments, got", strconv.Itoa(len(e.Value)-1)))
-		return nil, false
+	var expanded expr.Expr
+	var err error
+	if macro.Rules != nil {
+		expanded, err = evaluator.expandRules(macro, e)
+	} else {
+		if len(e.Value)-1 < len(macro.Closure.Params) {
+			return nil, evaluator.error(ArityError, e, "expect at least", strconv.Itoa(len(macro.Closure.Params)), "arguments, got", strconv.Itoa(len(e.Value)-1))
+		}
+		expanded, err = apply(evaluator, macro.Closure, e.Value[1:])
 	}
-
-	return apply(evaluator, macro.Closure, args)
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
 }
 
-func (evaluator Evaluator) Eval(e expr.Expr) (expr.Expr, bool) {
+// params parses a parameter list, a list or a vector of symbols or patterns
+// optionally ending with & and the variadic parameter. The patterns are
+// returned as Closure.Patterns.
+func (evaluator Evaluator) params(e expr.Expr) ([]string, string, []expr.Expr, error) {
+	var forms []expr.Expr
 	switch e := e.(type) {
-	case expr.Number, expr.String, expr.Bool, expr.Closure, nil:
-		return e, true
-
-	case expr.Symbol:
-		if v, ok := evaluator.env.Get(e.Value); ok {
-			return v, ok
-		}
-		fmt.Println(evaluator.errorInfo("repl", e, "undefined:", e.Value))
-		return nil, false
-
-	case expr.Nil:
-		return e, true
-
 	case expr.List:
-		if len(e.Value) == 0 {
-			return e, true
+		forms = e.Value
+	case expr.Vector:
+		forms = e.Value
+	default:
+		return nil, "", nil, evaluator.error(TypeError, e, "expect an argument list")
+	}
+	params := []string{}
+	exist := map[string]bool{}
+	var patterns []expr.Expr
+	// pattern records the pattern of the parameter i, which is named ""
+	pattern := func(i int, p expr.Expr) error {
+		if err := evaluator.checkPattern(p, exist); err != nil {
+			return err
+		}
+		if patterns == nil {
+			patterns = make([]expr.Expr, len(forms)+1)
+		}
+		patterns[i] = p
+		return nil
+	}
+	var i int
+	for ; i < len(forms); i++ {
+		if isPattern(forms[i]) {
+			if err := pattern(i, forms[i]); err != nil {
+				return nil, "", nil, err
+			}
+			params = append(params, "")
+			continue
 		}
-
-		if evaluator.isMacro(e.Value[0]) {
-			expanded, ok := evaluator.macroExpand(e)
+		p, ok := forms[i].(expr.Symbol)
+		if !ok {
+			return nil, "", nil, evaluator.error(TypeError, forms[i], "expect a symbol or a pattern")
+		}
+		if p.Value == "&" {
+			break
+		}
+		if exist[p.Value] {
+			return nil, "", nil, evaluator.error(NameError, e, "parameter name must be unique")
+		}
+		exist[p.Value] = true
+		params = append(params, p.Value)
+	}
+	var varparam string
+	if i < len(forms) {
+		if i != len(forms)-2 {
+			return nil, "", nil, evaluator.error(TypeError, forms[i], "expect a symbol after &")
+		}
+		if isPattern(forms[i+1]) {
+			if err := pattern(i, forms[i+1]); err != nil {
+				return nil, "", nil, err
+			}
+		} else {
+			v, ok := forms[i+1].(expr.Symbol)
 			if !ok {
-				return nil, false
+				return nil, "", nil, evaluator.error(TypeError, forms[i+1], "expect a symbol")
 			}
-			return evaluator.Eval(expanded)
+			varparam = v.Value
 		}
+	}
+	if patterns != nil {
+		patterns = patterns[:len(params)+1]
+	}
+	return params, varparam, patterns, nil
+}
 
-		if isSpecialForm(e) {
-			return evaluator.evalSpecialForm(e)
+// Eval evaluates e. Tail positions, i.e. the branches of if, the last form of
+// a closure body and the expansion of a macro, are evaluated by looping
+// instead of recursing, so tail calls run in constant Go stack.
+func (evaluator Evaluator) Eval(e expr.Expr) (expr.Expr, error) {
+	// the closures and macro expansions entered by looping, for the stack of errors
+	var tail tailFrames
+	// the innermost loop in tail position, recur jumps back to
+	var loop *loopState
+	fail := func(err error) (expr.Expr, error) {
+		return nil, tail.annotate(err)
+	}
+
+	if evaluator.run != nil {
+		if err := evaluator.run.enter(); err != nil {
+			evaluator.run.leave()
+			return nil, evaluator.limitError(err, e)
 		}
+		defer evaluator.run.leave()
+	}
 
-		operator, ok := evaluator.Eval(e.Value[0])
-		if !ok {
-			return nil, false
+	for {
+		if evaluator.run != nil {
+			if err := evaluator.run.step(); err != nil {
+				return fail(evaluator.limitError(err, e))
+			}
 		}
 
-		switch operator := operator.(type) {
-		case expr.Builtin:
-			args := []expr.Expr{operator}
-			for _, arg := range e.Value[1:] {
-				value, ok := evaluator.Eval(arg)
-				if !ok {
-					return nil, false
+		switch ex := e.(type) {
+		case expr.Int, expr.Float, expr.BigInt, expr.Decimal, expr.String, expr.Bool, expr.Error, expr.GoObject, expr.Module, expr.Closure, expr.Builtin, expr.Macro, nil:
+			return ex, nil
+
+		case expr.Symbol:
+			if v, ok := evaluator.lookup(ex.Value); ok {
+				return v, nil
+			}
+			return fail(evaluator.undefined(ex))
+
+		case expr.Nil:
+			return ex, nil
+
+		case expr.Map:
+			res, err := evaluator.evalMap(ex)
+			if err != nil {
+				return fail(err)
+			}
+			return res, nil
+
+		case expr.Vector:
+			res := make([]expr.Expr, len(ex.Value))
+			for i, item := range ex.Value {
+				value, err := evaluator.Eval(item)
+				if err != nil {
+					return fail(err)
 				}
-				args = append(args, value)
+				res[i] = value
 			}
-			proc, ok := evaluator.builtins[operator.Name]
-			if !ok {
-				panic("builtin not found")
+			return expr.NewVector(res...), nil
+
+		case expr.List:
+			if len(ex.Value) == 0 {
+				return ex, nil
 			}
-			return proc(evaluator, args...)
-
-		// invoke a closure
-		case expr.Closure:
-			if len(e.Value)-1 < len(operator.Params) {
-				fmt.Println(e, operator)
-				fmt.Println(evaluator.errorInfo("repl", operator, "expect at least", strconv.Itoa(len(operator.Params)), "arguments, got", strconv.Itoa(len(e.Value)-1)))
-				return nil, false
+
+			if evaluator.isMacro(ex.Value[0]) {
+				frame := evaluator.frame(callName(ex.Value[0]), ex)
+				frame.Macro = true
+				tail.push(frame, ex)
+				expanded, err := evaluator.macroExpand(ex)
+				if err != nil {
+					return fail(err)
+				}
+				evaluator = evaluator.expanding(ex, expanded)
+				e = expanded
+				continue
+			}
+
+			// the body of the matching clause is evaluated with its bindings,
+			// the last form in tail position
+			if headOf(ex) == expr.SF_MATCH {
+				scope, body, err := evaluator.evalMatch(ex)
+				if err != nil {
+					return fail(err)
+				}
+				if len(body) == 0 {
+					return expr.NewNil(), nil
+				}
+				evaluator = scope
+				for _, b := range body[:len(body)-1] {
+					if _, err := evaluator.Eval(b); err != nil {
+						return fail(err)
+					}
+				}
+				e = body[len(body)-1]
+				continue
 			}
 
-			args := []expr.Expr{}
-			for _, arg := range e.Value[1:] {
-				value, ok := evaluator.Eval(arg)
+			// recur rebinds the variables of the loop in place and evaluates
+			// its body again, the last form in tail position
+			if h := headOf(ex); h == expr.SF_LOOP || h == expr.SF_RECUR {
+				var err error
+				if h == expr.SF_LOOP {
+					loop, err = evaluator.enterLoop(ex)
+				} else {
+					err = evaluator.recur(loop, ex)
+				}
+				if err != nil {
+					return fail(err)
+				}
+				evaluator = loop.scope
+				next, err := loop.run()
+				if err != nil {
+					return fail(err)
+				}
+				e = next
+				continue
+			}
+
+			if isSpecialForm(ex) {
+				value, next, err := evaluator.evalSpecialForm(ex)
+				if err != nil {
+					return fail(err)
+				}
+				if next == nil {
+					return value, nil
+				}
+				e = next
+				continue
+			}
+
+			operator, err := evaluator.Eval(ex.Value[0])
+			if err != nil {
+				return fail(err)
+			}
+
+			switch operator := operator.(type) {
+			// the last argument of do is in tail position
+			case expr.Builtin:
+				if operator.Name == "do" && len(ex.Value) > 1 {
+					last := len(ex.Value) - 1
+					for _, arg := range ex.Value[1:last] {
+						if _, err := evaluator.Eval(arg); err != nil {
+							return fail(err)
+						}
+					}
+					e = ex.Value[last]
+					continue
+				}
+				args := make([]expr.Expr, 0, len(ex.Value))
+				args = append(args, operator)
+				for _, arg := range ex.Value[1:] {
+					value, err := evaluator.Eval(arg)
+					if err != nil {
+						return fail(err)
+					}
+					args = append(args, value)
+				}
+				proc, ok := evaluator.builtins[operator.Name]
 				if !ok {
-					return nil, false
+					return fail(evaluator.error(NameError, ex.Value[0], "builtin not registered:", operator.Name))
+				}
+				res, err := proc(evaluator.calling(ex, args), args...)
+				if err != nil {
+					return fail(evaluator.withFrame(err, operator.Name, ex))
+				}
+				return res, nil
+
+			// invoke a closure
+			case expr.Closure:
+				if len(ex.Value)-1 < len(operator.Params) {
+					return fail(evaluator.error(ArityError, ex, "expect at least", strconv.Itoa(len(operator.Params)), "arguments, got", strconv.Itoa(len(ex.Value)-1)))
+				}
+
+				args := make([]expr.Expr, 0, len(ex.Value)-1)
+				for _, arg := range ex.Value[1:] {
+					value, err := evaluator.Eval(arg)
+					if err != nil {
+						return fail(err)
+					}
+					args = append(args, value)
+				}
+
+				// the call replaces the current frame, its last body form is the new tail
+				next, err := evaluator.bind(operator, args)
+				if err != nil {
+					return fail(evaluator.withFrame(err, callName(ex.Value[0]), ex))
+				}
+				evaluator = next
+				// recur in an immediately called fn, like let, is still in the loop
+				if fn, ok := ex.Value[0].(expr.List); !ok || !isLambda(fn) {
+					loop = nil
+				}
+				tail.push(evaluator.frame(callName(ex.Value[0]), ex), ex)
+				last := len(operator.Body) - 1
+				for _, b := range operator.Body[:last] {
+					if _, err := evaluator.Eval(b); err != nil {
+						return fail(err)
+					}
 				}
-				args = append(args, value)
+				e = operator.Body[last]
+				continue
 			}
 
-			return apply(evaluator, operator, args)
+			return fail(evaluator.error(TypeError, ex.Value[0], "expect proc or function"))
 		}
 
-		fmt.Println(evaluator.errorInfo("repl", e.Value[0], "expect proc or function"))
-		return nil, false
+		panic("unexhaustive evaluation")
 	}
+}
 
-	panic("unexhaustive evaluation")
+// EvalString evaluates code, positions in errors have no file name.
+func (e Evaluator) EvalString(code string) (expr.Expr, error) {
+	return e.EvalStringNamed("", code)
 }
 
-func (e Evaluator) EvalString(code string) (expr.Expr, bool) {
+// EvalStringNamed evaluates code read from the file name, which positions in
+// errors refer to.
+func (e Evaluator) EvalStringNamed(name, code string) (expr.Expr, error) {
 	s := parser.NewScanner(code)
-	tokens, ok := s.Scan()
-	if !ok {
-		return nil, false
+	s.File = name
+	tokens, err := s.Scan()
+	if err != nil {
+		return nil, fromSyntaxError(err)
 	}
 	p := parser.New(tokens)
-	exprs, ok := p.Parse()
-	if !ok {
-		return nil, false
+	p.File = name
+	p.Positions = e.Positions
+	exprs, err := p.Parse()
+	if err != nil {
+		return nil, fromSyntaxError(err)
 	}
-	e.Positions = p.Positions
 	var last expr.Expr
 	for _, expr := range exprs {
-		v, ok := e.Eval(expr)
-		if !ok {
-			return nil, false
+		v, err := e.Eval(expr)
+		if err != nil {
+			return nil, err
 		}
 		last = v
 	}
-	return last, true
+	return last, nil
+}
+
+// EvalFile evaluates the file at path, see EvalStringNamed. An error reading
+// it is returned as is.
+func (e Evaluator) EvalFile(path string) (expr.Expr, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.EvalStringNamed(path, string(code))
 }
 
-func apply(e Evaluator, closure expr.Closure, args []expr.Expr) (expr.Expr, bool) {
+// bind returns an evaluator for the body of closure, with args bound to its
+// parameters in a new environment layer on top of the closure's environment.
+func (e Evaluator) bind(closure expr.Closure, args []expr.Expr) (Evaluator, error) {
 	env := expr.NewEnv()
+	e.env = closure.Env.AppendEnv(env)
+	e.step = nil
 	var i int
 	for ; i < len(closure.Params); i++ {
+		if closure.Patterns != nil && closure.Patterns[i] != nil {
+			if err := e.destructure(closure.Patterns[i], args[i]); err != nil {
+				return e, err
+			}
+			continue
+		}
 		env.Add(closure.Params[i], args[i])
 	}
-	env.Add(closure.VarParam, expr.NewList(args[i:]...))
+	if closure.Patterns != nil && closure.Patterns[i] != nil {
+		if err := e.destructure(closure.Patterns[i], expr.NewList(args[i:]...)); err != nil {
+			return e, err
+		}
+	} else {
+		env.Add(closure.VarParam, expr.NewList(args[i:]...))
+	}
+	return e, nil
+}
 
-	newEnv := closure.Env.AppendEnv(env)
-	newEvaluator := New()
-	newEvaluator.Positions = e.Positions
-	newEvaluator.env = newEnv
+// call calls the function value f with evaluated args, site is the form
+// causing the call, for error reporting.
+func (e Evaluator) call(f expr.Expr, args []expr.Expr, site expr.Expr) (expr.Expr, error) {
+	switch f := f.(type) {
+	case expr.Builtin:
+		proc, ok := e.builtins[f.Name]
+		if !ok {
+			return nil, e.error(NameError, site, "builtin not registered:", f.Name)
+		}
+		values := append([]expr.Expr{f}, args...)
+		res, err := proc(e.calling(site, values), values...)
+		if err != nil {
+			return nil, e.withFrame(err, f.Name, site)
+		}
+		return res, nil
+	case expr.Closure:
+		if len(args) < len(f.Params) {
+			return nil, e.error(ArityError, site, "expect at least", strconv.Itoa(len(f.Params)), "arguments, got", strconv.Itoa(len(args)))
+		}
+		res, err := apply(e, f, args)
+		if err != nil {
+			return nil, e.withFrame(err, "<closure>", site)
+		}
+		return res, nil
+	default:
+		return nil, e.error(TypeError, site, "expect proc or function, got", f.ExprName())
+	}
+}
+
+func apply(e Evaluator, closure expr.Closure, args []expr.Expr) (expr.Expr, error) {
+	newEvaluator, err := e.bind(closure, args)
+	if err != nil {
+		return nil, err
+	}
 
 	var last expr.Expr
 	for _, b := range closure.Body {
-		v, ok := newEvaluator.Eval(b)
-		if !ok {
-			return nil, false
+		v, err := newEvaluator.Eval(b)
+		if err != nil {
+			return nil, err
 		}
 		last = v
 	}
-	return last, true
+	return last, nil
+}
+
+// callName names the function called through operator for stack frames.
+func callName(operator expr.Expr) string {
+	if s, ok := operator.(expr.Symbol); ok {
+		return s.Value
+	}
+	return "<closure>"
 }
 
 func isTruthy(e expr.Expr) bool {
@@ -424,44 +740,54 @@ func isTruthy(e expr.Expr) bool {
 	}
 }
 
-func WithPrelude() Evaluator {
+// WithPrelude returns an evaluator like New, or like NewWith if sets are
+// given, with the standard library loaded.
+func WithPrelude(sets ...Builtins) Evaluator {
 	e := New()
-	_, ok := e.EvalString(stdlib.Prelude)
-	if !ok {
-		os.Exit(1)
+	if len(sets) > 0 {
+		e = NewWith(sets...)
+	}
+	prelude := e
+	prelude.env = e.env[:1]
+	_, err := prelude.EvalStringNamed("prelude.gl", stdlib.Prelude)
+	if err != nil {
+		panic(err)
 	}
 	return e
 }
 
 func (e Evaluator) InvokeFunc(name string, args ...any) (any, error) {
-	target, ok := e.env.Get(name)
+	target, ok := e.lookup(name)
 	if !ok {
-		return nil, fmt.Errorf("function %s doesn't exist", name)
+		return nil, &Error{Kind: NameError, Message: "undefined: " + name}
 	}
 	eles := []expr.Expr{target}
 	for _, a := range args {
-		eles = append(eles, expr.LVal(a))
+		// quoted, the converted values are arguments, not forms to evaluate
+		eles = append(eles, expr.NewList(expr.NewSymbol(expr.SF_QUOTE), expr.LVal(a)))
 	}
 	function := expr.NewList(eles...)
-	res, ok := e.Eval(function)
-	if !ok {
-		return nil, errors.New("evaluation failed")
+	res, err := e.Eval(function)
+	if err != nil {
+		return nil, err
 	}
-	return expr.GVal(res), nil
+	// functions returned outlive the run
+	e.run = nil
+	return e.gval(res), nil
 }
 
 func (e Evaluator) GetGlobal(name string) (any, error) {
-	target, ok := e.env.Get(name)
+	target, ok := e.lookup(name)
 	if !ok {
-		return nil, fmt.Errorf("global %s doesn't exist", name)
+		return nil, &Error{Kind: NameError, Message: "undefined: " + name}
 	}
-	return expr.GVal(target), nil
+	return e.gval(target), nil
 }
 
 func (e Evaluator) SetGlobal(name string, val any) (any, error) {
 	_, ok := e.env.Get(name)
 	if !ok {
-		return nil, fmt.Errorf("global %s doesn't exist", name)
+		return nil, &Error{Kind: NameError, Message: "undefined: " + name}
 	}
 	e.env.Set(name, expr.LVal(val))
 	return nil, nil
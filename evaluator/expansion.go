@@ -0,0 +1,89 @@
+package evaluator
+
+import (
+	"github.com/guiyuanju/golisp/expr"
+	"github.com/guiyuanju/golisp/parser"
+)
+
+// expansion is the expansion of a macro call being evaluated, outer the one
+// being evaluated when the call was expanded. The forms of an expansion are
+// located when an error is reported rather than when expanded, so that
+// expanding at run time records nothing.
+type expansion struct {
+	call     expr.List
+	expanded expr.Expr
+	outer    *expansion
+	depth    int
+}
+
+// maxExpansionDepth bounds the expansions forms are located in, the outer
+// ones are forgotten beyond it, like those of the iterations of a loop.
+const maxExpansionDepth = 32
+
+// expanding returns e evaluating expanded, the expansion of the macro call.
+func (e Evaluator) expanding(call expr.List, expanded expr.Expr) Evaluator {
+	x := &expansion{call: call, expanded: expanded, outer: e.expansion}
+	if x.outer != nil {
+		x.depth = x.outer.depth + 1
+	}
+	if x.depth == maxExpansionDepth {
+		x.outer, x.depth = nil, 0
+	}
+	e.expansion = x
+	return e
+}
+
+// built reports whether ex is a form of the expansion other than the forms of
+// the arguments of the call.
+func (x *expansion) built(ex expr.Expr) bool {
+	args := map[int]bool{}
+	var mark func(e expr.Expr)
+	mark = func(e expr.Expr) {
+		args[e.ExprId()] = true
+		for _, item := range subforms(e) {
+			mark(item)
+		}
+	}
+	for _, arg := range x.call.Value[1:] {
+		mark(arg)
+	}
+
+	id := ex.ExprId()
+	var find func(e expr.Expr) bool
+	find = func(e expr.Expr) bool {
+		if args[e.ExprId()] {
+			return false
+		}
+		if e.ExprId() == id {
+			return true
+		}
+		for _, item := range subforms(e) {
+			if find(item) {
+				return true
+			}
+		}
+		return false
+	}
+	return find(x.expanded)
+}
+
+// locate returns the source position of ex and, if ex was expanded from a
+// macro call, the frame of the call. Forms built by the macro have the
+// position of the call.
+func (e Evaluator) locate(ex expr.Expr) (parser.Position, *Frame) {
+	pos, ok := e.Positions[ex.ExprId()]
+	for x := e.expansion; x != nil; x = x.outer {
+		if !x.built(ex) {
+			continue
+		}
+		outer := e
+		outer.expansion = x.outer
+		from := outer.frame(callName(x.call.Value[0]), x.call)
+		from.Macro = true
+		if !ok {
+			pos = from.Position
+		}
+		return pos, &from
+	}
+	return pos, nil
+}
@@ -0,0 +1,104 @@
+package evaluator
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+// RegisterFunc registers the Go function fn in the default layer, like
+// RegisterBuiltin but with arguments and results converted by fn's signature.
+// It panics if fn is not a function.
+func RegisterFunc(name string, fn any) {
+	registerBuiltin(name, funcProc(fn))
+}
+
+// RegisterFunc adds the Go function fn to the set, see RegisterFunc.
+func (b Builtins) RegisterFunc(name string, fn any) {
+	b[name] = funcProc(fn)
+}
+
+// RegisterFunc makes the Go function fn callable by name from scripts run by
+// this evaluator only, see RegisterFunc.
+func (e Evaluator) RegisterFunc(name string, fn any) {
+	e.RegisterProc(name, funcProc(fn))
+}
+
+// funcProc adapts any Go function to a Proc. Arguments are converted to the
+// parameter types, a leading context.Context parameter receives the context
+// of the run. A trailing error result is reported as a host error, the other
+// results are converted back: none is nil, several are a list.
+func funcProc(fn any) Proc {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func {
+		panic(fmt.Sprintf("golisp: RegisterFunc of %T, expect a function", fn))
+	}
+	return reflectProc(f)
+}
+
+// reflectProc adapts the function value f to a Proc, see funcProc.
+func reflectProc(f reflect.Value) Proc {
+	t := f.Type()
+	first := 0
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		first = 1
+	}
+	outs := t.NumOut()
+	withErr := outs > 0 && t.Out(outs-1) == errorType
+	if withErr {
+		outs--
+	}
+
+	return func(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+		args := values[1:]
+		n := t.NumIn() - first
+		if t.IsVariadic() && len(args) < n-1 {
+			return nil, e.error(ArityError, values[0], fmt.Sprintf("expect at least %d arguments, got %d", n-1, len(args)))
+		}
+		if !t.IsVariadic() && len(args) != n {
+			return nil, e.error(ArityError, values[0], fmt.Sprintf("expect %d arguments, got %d", n, len(args)))
+		}
+
+		in := make([]reflect.Value, 0, first+len(args))
+		if first == 1 {
+			in = append(in, reflect.ValueOf(e.context()))
+		}
+		for i, arg := range args {
+			var pt reflect.Type
+			if t.IsVariadic() && first+i >= t.NumIn()-1 {
+				pt = t.In(t.NumIn() - 1).Elem()
+			} else {
+				pt = t.In(first + i)
+			}
+			v, err := e.fromLisp(arg, pt)
+			if err != nil {
+				return nil, e.error(TypeError, values[0], fmt.Sprintf("argument %d: %v", i+1, err))
+			}
+			in = append(in, v)
+		}
+
+		out := f.Call(in)
+		if withErr {
+			if err, _ := out[outs].Interface().(error); err != nil {
+				return nil, e.hostError(err, values[0])
+			}
+		}
+		res := make([]expr.Expr, outs)
+		for i := range res {
+			v, err := e.toLisp(out[i])
+			if err != nil {
+				return nil, e.error(TypeError, values[0], fmt.Sprintf("result %d: %v", i+1, err))
+			}
+			res[i] = v
+		}
+		switch outs {
+		case 0:
+			return expr.NewNil(), nil
+		case 1:
+			return res[0], nil
+		default:
+			return expr.NewList(res...), nil
+		}
+	}
+}
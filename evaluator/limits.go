@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+var (
+	ErrStepLimit  = errors.New("step limit exceeded")
+	ErrDepthLimit = errors.New("depth limit exceeded")
+	ErrListLimit  = errors.New("list size limit exceeded")
+)
+
+// Limits bounds a single run of EvalContext, EvalStringContext or
+// InvokeFuncContext. Zero fields are unlimited.
+type Limits struct {
+	MaxSteps    int           // evaluation steps, each form evaluated is a step
+	MaxDepth    int           // nested non-tail evaluations, bounds the Go stack
+	MaxListSize int           // length of a list, vector or map created by a builtin
+	Timeout     time.Duration // wall-clock time, in addition to the context's deadline
+}
+
+// run is the state of a limited run, shared by all evaluators of the run.
+type run struct {
+	ctx    context.Context
+	limits Limits
+	steps  int
+	depth  int
+}
+
+// the context is polled every ctxPollSteps steps
+const ctxPollSteps = 64
+
+func (r *run) step() error {
+	r.steps++
+	if r.limits.MaxSteps > 0 && r.steps > r.limits.MaxSteps {
+		return ErrStepLimit
+	}
+	if r.steps%ctxPollSteps == 0 {
+		return r.ctx.Err()
+	}
+	return nil
+}
+
+func (r *run) enter() error {
+	r.depth++
+	if r.limits.MaxDepth > 0 && r.depth > r.limits.MaxDepth {
+		return ErrDepthLimit
+	}
+	return nil
+}
+
+func (r *run) leave() {
+	r.depth--
+}
+
+// withRun returns an evaluator whose evaluation is bounded by ctx and limits,
+// and a function releasing the resources of the run.
+func (e Evaluator) withRun(ctx context.Context, limits Limits) (Evaluator, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+	}
+	e.run = &run{ctx: ctx, limits: limits}
+	return e, cancel
+}
+
+// context returns the context of the current run.
+func (e Evaluator) context() context.Context {
+	if e.run == nil {
+		return context.Background()
+	}
+	return e.run.ctx
+}
+
+func (e Evaluator) limitError(err error, ex expr.Expr) *Error {
+	le := e.error(LimitError, ex, err.Error())
+	le.Err = err
+	return le
+}
+
+// checkListSize reports whether a list, vector or map of n elements may be
+// created.
+func (e Evaluator) checkListSize(n int, ex expr.Expr) error {
+	if e.run == nil || e.run.limits.MaxListSize <= 0 || n <= e.run.limits.MaxListSize {
+		return nil
+	}
+	return e.limitError(ErrListLimit, ex)
+}
+
+// EvalContext is like Eval, but stops with a LimitError once ctx is done or
+// a limit is exceeded.
+func (e Evaluator) EvalContext(ctx context.Context, limits Limits, ex expr.Expr) (expr.Expr, error) {
+	e, cancel := e.withRun(ctx, limits)
+	defer cancel()
+	return e.Eval(ex)
+}
+
+// EvalStringContext is like EvalString, but stops with a LimitError once ctx
+// is done or a limit is exceeded.
+func (e Evaluator) EvalStringContext(ctx context.Context, limits Limits, code string) (expr.Expr, error) {
+	e, cancel := e.withRun(ctx, limits)
+	defer cancel()
+	return e.EvalString(code)
+}
+
+// InvokeFuncContext is like InvokeFunc, but stops with a LimitError once ctx
+// is done or a limit is exceeded.
+func (e Evaluator) InvokeFuncContext(ctx context.Context, limits Limits, name string, args ...any) (any, error) {
+	e, cancel := e.withRun(ctx, limits)
+	defer cancel()
+	return e.InvokeFunc(name, args...)
+}
@@ -0,0 +1,399 @@
+package evaluator
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+// Native iteration. loop binds its variables in an environment layer of its
+// own, which recur clears and rebinds in place before jumping back to the
+// body, and while, dotimes and for-each reuse a single layer for all their
+// steps, so iterating allocates no evaluator nor layer per step. Once a
+// closure, which may outlive the step, is created in the scope of the layer,
+// the next step gets a new one, so that the closure keeps its bindings.
+
+// stepLayer is the environment layer of the steps of a loop, outer the one
+// of the enclosing loop, if any.
+type stepLayer struct {
+	captured bool
+	loop     bool // of loop rather than while, dotimes or for-each
+	outer    *stepLayer
+}
+
+// capture marks s and the layers enclosing it as captured by a closure.
+func (s *stepLayer) capture() {
+	for ; s != nil && !s.captured; s = s.outer {
+		s.captured = true
+	}
+}
+
+// stepScope returns an evaluator with a new layer for the bindings of the
+// steps of a loop.
+func (evaluator Evaluator) stepScope(loop bool) Evaluator {
+	evaluator.env = evaluator.env.AppendEnv(expr.NewEnv())
+	evaluator.step = &stepLayer{loop: loop, outer: evaluator.step}
+	return evaluator
+}
+
+// nextStep returns the scope of a loop for its next step, with the layer of
+// the bindings cleared, or replaced if it was captured.
+func (evaluator Evaluator) nextStep() Evaluator {
+	last := len(evaluator.env) - 1
+	if evaluator.step.captured {
+		evaluator.env = evaluator.env[:last].AppendEnv(expr.NewEnv())
+		evaluator.step.captured = false
+		return evaluator
+	}
+	clear(evaluator.env[last])
+	return evaluator
+}
+
+// loopState is the loop recur jumps back to.
+type loopState struct {
+	scope    Evaluator
+	patterns []expr.Expr
+	body     []expr.Expr
+	args     []expr.Expr
+}
+
+// enterLoop evaluates the bindings of (loop (pattern value ...) body...), each
+// value seeing the bindings before it, after checking that every recur in body
+// is in tail position.
+func (evaluator Evaluator) enterLoop(e expr.List) (*loopState, error) {
+	if len(e.Value) < 3 {
+		return nil, evaluator.error(ArityError, e.Value[0], "expect bindings and a body")
+	}
+	bindings := items(e.Value[1])
+	if !isSeq(e.Value[1]) || len(bindings)%2 != 0 {
+		return nil, evaluator.error(SyntaxError, e.Value[1], "expect a pattern and a value for each binding")
+	}
+	l := &loopState{body: e.Value[2:]}
+	names := map[string]bool{}
+	for i := 0; i < len(bindings); i += 2 {
+		if err := evaluator.checkPattern(bindings[i], names); err != nil {
+			return nil, err
+		}
+		l.patterns = append(l.patterns, bindings[i])
+	}
+	for i, b := range l.body {
+		if err := evaluator.checkRecur(b, i == len(l.body)-1, len(l.patterns)); err != nil {
+			return nil, err
+		}
+	}
+
+	l.scope = evaluator.stepScope(true)
+	for i := 0; i < len(bindings); i += 2 {
+		value, err := l.scope.Eval(bindings[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if err := l.scope.destructure(bindings[i], value); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// recur evaluates the values of (recur value...) and rebinds the variables of
+// the loop l to them.
+func (evaluator Evaluator) recur(l *loopState, e expr.List) error {
+	if l == nil {
+		// a recur the check before the loop couldn't see, as one in the
+		// arguments of a macro
+		for s := evaluator.step; s != nil; s = s.outer {
+			if s.loop {
+				return evaluator.error(SyntaxError, e, "recur not in tail position of loop")
+			}
+		}
+		return evaluator.error(SyntaxError, e.Value[0], "recur outside of loop")
+	}
+	if len(e.Value)-1 != len(l.patterns) {
+		return evaluator.error(ArityError, e, "expect", strconv.Itoa(len(l.patterns)), "values, got", strconv.Itoa(len(e.Value)-1))
+	}
+	l.args = l.args[:0]
+	for _, arg := range e.Value[1:] {
+		value, err := evaluator.Eval(arg)
+		if err != nil {
+			return err
+		}
+		l.args = append(l.args, value)
+	}
+	l.scope = l.scope.nextStep()
+	for i, p := range l.patterns {
+		if err := l.scope.destructure(p, l.args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run evaluates the body of l but its last form, returned to be evaluated in
+// tail position.
+func (l *loopState) run() (expr.Expr, error) {
+	last := len(l.body) - 1
+	for _, b := range l.body[:last] {
+		if _, err := l.scope.Eval(b); err != nil {
+			return nil, err
+		}
+	}
+	return l.body[last], nil
+}
+
+// checkRecur reports a recur in e that isn't in tail position of the loop,
+// tail telling whether e itself is, or doesn't have arity values. The last
+// forms of if, match, do and of an immediately called fn keep the position
+// of the form. Nested loops are checked when they are entered, macro calls
+// aren't expanded, which may have effects, so recur reports a recur in their
+// arguments not in tail position of the expansion when evaluated.
+func (evaluator Evaluator) checkRecur(e expr.Expr, tail bool, arity int) error {
+	l, ok := e.(expr.List)
+	if !ok {
+		for _, item := range subforms(e) {
+			if err := evaluator.checkRecur(item, false, arity); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(l.Value) == 0 {
+		return nil
+	}
+	body := func(forms []expr.Expr) error {
+		for i, form := range forms {
+			if err := evaluator.checkRecur(form, tail && i == len(forms)-1, arity); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	args := func(forms []expr.Expr) error {
+		for _, form := range forms {
+			if err := evaluator.checkRecur(form, false, arity); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if fn, ok := l.Value[0].(expr.List); ok && isLambda(fn) {
+		if err := args(l.Value[1:]); err != nil {
+			return err
+		}
+		return body(fn.Value[2:])
+	}
+	switch headOf(l) {
+	case expr.SF_RECUR:
+		if !tail {
+			return evaluator.error(SyntaxError, l, "recur not in tail position of loop")
+		}
+		if len(l.Value)-1 != arity {
+			return evaluator.error(ArityError, l, "expect", strconv.Itoa(arity), "values, got", strconv.Itoa(len(l.Value)-1))
+		}
+		return args(l.Value[1:])
+	case expr.SF_QUOTE, expr.SF_QUASIQUOTE, expr.SF_MACRO, expr.SF_SYNTAX_RULES:
+		return nil
+	case expr.SF_LOOP:
+		bindings := items(l.Value[min(len(l.Value)-1, 1)])
+		for i := 1; i < len(bindings); i += 2 {
+			if err := evaluator.checkRecur(bindings[i], false, arity); err != nil {
+				return err
+			}
+		}
+		return nil
+	case expr.SF_IF:
+		if err := args(l.Value[1:min(len(l.Value), 2)]); err != nil {
+			return err
+		}
+		for _, branch := range l.Value[min(len(l.Value), 2):] {
+			if err := evaluator.checkRecur(branch, tail, arity); err != nil {
+				return err
+			}
+		}
+		return nil
+	case expr.SF_MATCH:
+		if err := args(l.Value[1:min(len(l.Value), 2)]); err != nil {
+			return err
+		}
+		for _, c := range l.Value[min(len(l.Value), 2):] {
+			clause := items(c)
+			if len(clause) == 0 {
+				continue
+			}
+			forms := clause[1:]
+			if len(forms) > 1 && isSymbol(forms[0], guardKeyword) {
+				if err := evaluator.checkRecur(forms[1], false, arity); err != nil {
+					return err
+				}
+				forms = forms[2:]
+			}
+			if err := body(forms); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "do":
+		return body(l.Value[1:])
+	}
+	if evaluator.isMacro(l.Value[0]) {
+		return nil
+	}
+	return args(l.Value)
+}
+
+// isLambda reports whether e is an anonymous fn form.
+func isLambda(e expr.List) bool {
+	if headOf(e) != expr.SF_FN || len(e.Value) < 3 {
+		return false
+	}
+	_, named := e.Value[1].(expr.Symbol)
+	return !named
+}
+
+// (while test body...) evaluates body as long as test is true, for a value
+// of nil.
+func (evaluator Evaluator) evalWhile(e expr.List) (expr.Expr, error) {
+	if len(e.Value) < 2 {
+		return nil, evaluator.error(ArityError, e.Value[0], "expect a test and a body")
+	}
+	scope := evaluator.stepScope(false)
+	for {
+		ok, err := evaluator.Eval(e.Value[1])
+		if err != nil {
+			return nil, err
+		}
+		if !isTruthy(ok) {
+			return expr.NewNil(), nil
+		}
+		scope = scope.nextStep()
+		if _, err := scope.evalBody(e.Value[2:]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// stepBinding returns the pattern and the value of the binding (pattern
+// value) of dotimes and for-each, with the value evaluated.
+func (evaluator Evaluator) stepBinding(e expr.List) (expr.Expr, expr.Expr, error) {
+	if len(e.Value) < 2 {
+		return nil, nil, evaluator.error(ArityError, e.Value[0], "expect a binding and a body")
+	}
+	binding := items(e.Value[1])
+	if !isSeq(e.Value[1]) || len(binding) != 2 {
+		return nil, nil, evaluator.error(SyntaxError, e.Value[1], "expect a binding (pattern value)")
+	}
+	if err := evaluator.checkPattern(binding[0], map[string]bool{}); err != nil {
+		return nil, nil, err
+	}
+	value, err := evaluator.Eval(binding[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return binding[0], value, nil
+}
+
+// (dotimes (i n) body...) evaluates body with i bound to 0 up to n - 1, for a
+// value of nil.
+func (evaluator Evaluator) evalDotimes(e expr.List) (expr.Expr, error) {
+	pattern, value, err := evaluator.stepBinding(e)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := value.(expr.Int)
+	if !ok {
+		return nil, evaluator.error(TypeError, items(e.Value[1])[1], "expect int, got", value.ExprName())
+	}
+	scope := evaluator.stepScope(false)
+	for i := int64(0); i < n.Value; i++ {
+		scope = scope.nextStep()
+		if err := scope.destructure(pattern, expr.NewInt(i)); err != nil {
+			return nil, err
+		}
+		if _, err := scope.evalBody(e.Value[2:]); err != nil {
+			return nil, err
+		}
+	}
+	return expr.NewNil(), nil
+}
+
+// (for-each (pattern xs) body...) evaluates body with pattern bound to each
+// item of the list or vector xs, or each entry (key value) of the map xs in
+// the order of keys, for a value of nil.
+func (evaluator Evaluator) evalForEach(e expr.List) (expr.Expr, error) {
+	pattern, value, err := evaluator.stepBinding(e)
+	if err != nil {
+		return nil, err
+	}
+	var seq expr.Seq
+	switch v := value.(type) {
+	case expr.Seq:
+		seq = v
+	case expr.Map:
+		entries := make([]expr.Expr, 0, v.Len())
+		for _, entry := range v.Entries() {
+			entries = append(entries, expr.NewList(entry.Key, entry.Value))
+		}
+		seq = expr.NewList(entries...)
+	default:
+		return nil, evaluator.error(TypeError, items(e.Value[1])[1], "expect list, vector or map, got", value.ExprName())
+	}
+	scope := evaluator.stepScope(false)
+	for i := 0; i < seq.Len(); i++ {
+		scope = scope.nextStep()
+		if err := scope.destructure(pattern, seq.Get(i)); err != nil {
+			return nil, err
+		}
+		if _, err := scope.evalBody(e.Value[2:]); err != nil {
+			return nil, err
+		}
+	}
+	return expr.NewNil(), nil
+}
+
+// (range end), (range start end) or (range start end step) returns the list
+// of ints from start, 0 by default, up to but excluding end by step, 1 by
+// default.
+func _range(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 || len(values) > 4 {
+		return nil, e.error(ArityError, values[0], "need 1 to 3 arguments")
+	}
+	args := make([]int64, len(values)-1)
+	for i, v := range values[1:] {
+		n, ok := v.(expr.Int)
+		if !ok {
+			return nil, e.error(TypeError, v, "expect int, got", v.ExprName())
+		}
+		args[i] = n.Value
+	}
+	start, end, step := int64(0), args[0], int64(1)
+	if len(args) > 1 {
+		start, end = args[0], args[1]
+	}
+	if len(args) > 2 {
+		step = args[2]
+	}
+	if step == 0 {
+		return nil, e.error(RuntimeError, values[3], "step must not be zero")
+	}
+
+	// the count is computed unsigned, as end - start may overflow
+	var n uint64
+	switch {
+	case step > 0 && start < end:
+		n = (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		n = (uint64(start)-uint64(end)-1)/-uint64(step) + 1
+	}
+	if n > math.MaxInt32 {
+		return nil, e.error(RuntimeError, values[0], "range of", strconv.FormatUint(n, 10), "items is too large")
+	}
+	if err := e.checkListSize(int(n), values[0]); err != nil {
+		return nil, err
+	}
+	res := make([]expr.Expr, n)
+	for i := range res {
+		res[i] = expr.NewInt(start + int64(i)*step)
+	}
+	return expr.NewList(res...), nil
+}
@@ -0,0 +1,85 @@
+package evaluator
+
+import (
+	"github.com/guiyuanju/golisp/expr"
+)
+
+// guardKeyword introduces the guard of a match clause.
+const guardKeyword = ":when"
+
+// evalMatch evaluates (match value (pattern body...) ...), see pattern.go for
+// the kinds of patterns. A clause may have a guard, (pattern :when guard body...),
+// evaluated with the bindings of the pattern. It returns the body of the first
+// clause whose pattern matches and whose guard holds, with an evaluator in
+// which its bindings are visible. If no clause matches, it reports a warning
+// and returns no body, for a value of nil.
+func (evaluator Evaluator) evalMatch(e expr.List) (Evaluator, []expr.Expr, error) {
+	s := e.Value[0]
+	if len(e.Value) < 2 {
+		return evaluator, nil, evaluator.error(ArityError, s, "expect a value and clauses")
+	}
+	value, err := evaluator.Eval(e.Value[1])
+	if err != nil {
+		return evaluator, nil, err
+	}
+	if value == nil {
+		// as returned by a host builtin
+		value = expr.NewNil()
+	}
+	for _, c := range e.Value[2:] {
+		clause, ok := c.(expr.List)
+		if !ok || len(clause.Value) == 0 {
+			return evaluator, nil, evaluator.error(SyntaxError, c, "expect a clause (pattern body...)")
+		}
+		pattern, body := clause.Value[0], clause.Value[1:]
+		var guard expr.Expr
+		if len(body) > 0 && isSymbol(body[0], guardKeyword) {
+			if len(body) < 2 {
+				return evaluator, nil, evaluator.error(SyntaxError, body[0], "expect a guard after", guardKeyword)
+			}
+			guard, body = body[1], body[2:]
+		}
+		if err := evaluator.checkPattern(pattern, map[string]bool{}); err != nil {
+			return evaluator, nil, err
+		}
+
+		scope := evaluator
+		scope.env = evaluator.env.AppendEnv(expr.NewEnv())
+		m, err := scope.bindPattern(pattern, value)
+		if err != nil {
+			return evaluator, nil, err
+		}
+		if m != nil {
+			continue
+		}
+		if guard != nil {
+			ok, err := scope.Eval(guard)
+			if err != nil {
+				return evaluator, nil, err
+			}
+			if !isTruthy(ok) {
+				continue
+			}
+		}
+		return scope, body, nil
+	}
+	evaluator.warning(evaluator.error(RuntimeError, s, "no clause matches", value.String()))
+	return evaluator, nil, nil
+}
+
+func isSymbol(e expr.Expr, name string) bool {
+	s, ok := e.(expr.Symbol)
+	return ok && s.Value == name
+}
+
+// OnWarning sets the function warnings are reported to, like a match no
+// clause matches. By default, or with a nil f, they are discarded.
+func (e Evaluator) OnWarning(f func(w *Error)) {
+	*e.warn = f
+}
+
+func (e Evaluator) warning(w *Error) {
+	if e.warn != nil && *e.warn != nil {
+		(*e.warn)(w)
+	}
+}
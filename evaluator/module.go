@@ -0,0 +1,271 @@
+package evaluator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/guiyuanju/golisp/expr"
+	"github.com/guiyuanju/golisp/parser"
+)
+
+// moduleExt is added to import paths without an extension.
+const moduleExt = ".gl"
+
+// loader loads the modules imported by an evaluator, shared by its copies.
+type loader struct {
+	roots   []fs.FS
+	cache   map[string]expr.Module // by key
+	loading []string               // keys of the modules being loaded, outermost first
+}
+
+// module is the state of a module file being loaded.
+type module struct {
+	name     string
+	root     int
+	dir      string
+	exports  []string
+	declared bool
+}
+
+func newLoader() *loader {
+	return &loader{cache: map[string]expr.Module{}}
+}
+
+// AddModulePath adds directories to search for imported modules, in order.
+func (e Evaluator) AddModulePath(dirs ...string) {
+	for _, dir := range dirs {
+		e.modules.roots = append(e.modules.roots, os.DirFS(dir))
+	}
+}
+
+// AddModuleFS adds a file system to search for imported modules, after the
+// ones added before.
+func (e Evaluator) AddModuleFS(fsys fs.FS) {
+	e.modules.roots = append(e.modules.roots, fsys)
+}
+
+// (module name (export name ...) ...) declares the module of the file being
+// imported, a module without export clauses exports all its definitions.
+func (evaluator Evaluator) defineModule(e expr.List) error {
+	m := evaluator.module
+	if m == nil {
+		return evaluator.error(RuntimeError, e, "module declared outside of an imported file")
+	}
+	if m.declared {
+		return evaluator.error(RuntimeError, e, "module already declared")
+	}
+	if len(e.Value) < 2 {
+		return evaluator.error(ArityError, e, "expect a module name")
+	}
+	name, ok := e.Value[1].(expr.Symbol)
+	if !ok {
+		return evaluator.error(TypeError, e.Value[1], "expect a symbol")
+	}
+	for _, clause := range e.Value[2:] {
+		l, ok := clause.(expr.List)
+		if !ok || headOf(l) != "export" {
+			return evaluator.error(TypeError, clause, "expect an export clause")
+		}
+		for _, v := range l.Value[1:] {
+			s, ok := v.(expr.Symbol)
+			if !ok {
+				return evaluator.error(TypeError, v, "expect a symbol")
+			}
+			m.exports = append(m.exports, s.Value)
+		}
+	}
+	m.name = name.Value
+	m.declared = true
+	return nil
+}
+
+// (import "path" :as alias) loads the module at path once and binds it to
+// alias, or to its name.
+func (evaluator Evaluator) importModule(e expr.List) (expr.Expr, error) {
+	if len(e.Value) != 2 && len(e.Value) != 4 {
+		return nil, evaluator.error(ArityError, e, "expect a path and an optional :as alias")
+	}
+	p, ok := e.Value[1].(expr.String)
+	if !ok {
+		return nil, evaluator.error(TypeError, e.Value[1], "expect a path string")
+	}
+	var alias string
+	if len(e.Value) == 4 {
+		as, ok := e.Value[2].(expr.Symbol)
+		if !ok || as.Value != ":as" {
+			return nil, evaluator.error(TypeError, e.Value[2], "expect :as")
+		}
+		a, ok := e.Value[3].(expr.Symbol)
+		if !ok {
+			return nil, evaluator.error(TypeError, e.Value[3], "expect a symbol")
+		}
+		alias = a.Value
+	}
+
+	mod, err := evaluator.load(p.Value, e)
+	if err != nil {
+		return nil, err
+	}
+	if alias == "" {
+		alias = mod.Name
+	}
+	if old, ok := evaluator.env.Get(alias); ok && old.Equal(mod) {
+		return mod, nil
+	}
+	if !evaluator.env.Add(alias, mod) {
+		return nil, evaluator.error(NameError, e, "already defined:", alias)
+	}
+	return mod, nil
+}
+
+// load returns the module at path p, evaluating its file the first time.
+func (evaluator Evaluator) load(p string, site expr.Expr) (expr.Module, error) {
+	l := evaluator.modules
+	if path.Ext(p) == "" {
+		p += moduleExt
+	}
+	root, name, src, err := evaluator.find(p)
+	if err != nil {
+		return expr.Module{}, evaluator.error(NameError, site, "cannot import", p+":", err.Error())
+	}
+	key := strconv.Itoa(root) + ":" + name
+	if mod, ok := l.cache[key]; ok {
+		return mod, nil
+	}
+	for i, k := range l.loading {
+		if k == key {
+			cycle := append(slices.Clone(l.loading[i:]), key)
+			for j := range cycle {
+				_, cycle[j], _ = strings.Cut(cycle[j], ":")
+			}
+			return expr.Module{}, evaluator.error(RuntimeError, site, "circular import:", strings.Join(cycle, " -> "))
+		}
+	}
+	l.loading = append(l.loading, key)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	s := parser.NewScanner(string(src))
+	s.File = name
+	tokens, err := s.Scan()
+	if err != nil {
+		return expr.Module{}, fromSyntaxError(err)
+	}
+	ps := parser.New(tokens)
+	ps.File = name
+	ps.Positions = evaluator.Positions
+	forms, err := ps.Parse()
+	if err != nil {
+		return expr.Module{}, fromSyntaxError(err)
+	}
+
+	m := &module{
+		name: strings.TrimSuffix(path.Base(name), path.Ext(name)),
+		root: root,
+		dir:  path.Dir(name),
+	}
+	modEvaluator := evaluator
+	modEvaluator.env = evaluator.env[:1].AppendEnv(expr.NewEnv())
+	modEvaluator.module = m
+	for _, form := range forms {
+		if _, err := modEvaluator.Eval(form); err != nil {
+			return expr.Module{}, err
+		}
+	}
+
+	layer := modEvaluator.env[len(modEvaluator.env)-1]
+	exports := m.exports
+	if exports == nil {
+		exports = make([]string, 0, len(layer))
+		for k := range layer {
+			exports = append(exports, k)
+		}
+		sort.Strings(exports)
+	}
+	for _, name := range exports {
+		if _, ok := layer[name]; !ok {
+			return expr.Module{}, evaluator.error(NameError, site, "module", m.name, "exports undefined", name)
+		}
+	}
+	mod := expr.NewModule(m.name, key, exports, modEvaluator.env)
+	l.cache[key] = mod
+	return mod, nil
+}
+
+// find reads the module file p, relative to the directory of the module
+// being loaded if p starts with ./ or ../, else from the first root having it.
+func (evaluator Evaluator) find(p string) (root int, name string, src []byte, err error) {
+	l := evaluator.modules
+	if m := evaluator.module; m != nil && (strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../")) {
+		name = path.Join(m.dir, p)
+		if !fs.ValidPath(name) {
+			return 0, "", nil, errors.New("path outside of the module root")
+		}
+		src, err = fs.ReadFile(l.roots[m.root], name)
+		return m.root, name, src, err
+	}
+	name = path.Clean(p)
+	if !fs.ValidPath(name) {
+		return 0, "", nil, errors.New("invalid module path")
+	}
+	for i, fsys := range l.roots {
+		src, err = fs.ReadFile(fsys, name)
+		if err == nil {
+			return i, name, src, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return 0, "", nil, err
+		}
+	}
+	return 0, "", nil, errors.New("not found in module paths")
+}
+
+// lookup returns the value of the symbol name, a qualified name like
+// pricing/apply is looked up in the exports of the module pricing.
+func (evaluator Evaluator) lookup(name string) (expr.Expr, bool) {
+	if v, ok := evaluator.env.Get(name); ok {
+		return v, true
+	}
+	alias, member, ok := splitQualified(name)
+	if !ok {
+		return nil, false
+	}
+	v, ok := evaluator.env.Get(alias)
+	if !ok {
+		return nil, false
+	}
+	mod, ok := v.(expr.Module)
+	if !ok {
+		return nil, false
+	}
+	return mod.Get(member)
+}
+
+// undefined reports the symbol name as undefined, or as not exported by its
+// module.
+func (evaluator Evaluator) undefined(s expr.Symbol) *Error {
+	if alias, member, ok := splitQualified(s.Value); ok {
+		if v, ok := evaluator.env.Get(alias); ok {
+			if mod, ok := v.(expr.Module); ok {
+				if _, ok := mod.Env[len(mod.Env)-1][member]; ok {
+					return evaluator.error(NameError, s, "not exported:", s.Value)
+				}
+			}
+		}
+	}
+	return evaluator.error(NameError, s, "undefined:", s.Value)
+}
+
+// splitQualified splits a name like pricing/apply, but not / itself.
+func splitQualified(name string) (alias, member string, ok bool) {
+	i := strings.IndexByte(name, '/')
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
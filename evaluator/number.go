@@ -0,0 +1,572 @@
+package evaluator
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+var (
+	errOverflow = errors.New("integer overflow")
+	errDivZero  = errors.New("division by zero")
+)
+
+// numKind orders the numeric types, an operation on two numbers works on
+// the greater kind of the two.
+type numKind int
+
+const (
+	intKind numKind = iota
+	bigKind
+	decimalKind
+	floatKind
+)
+
+// num is a numeric operand, of the kind it holds. scale is the scale of a
+// decimal.
+type num struct {
+	kind  numKind
+	i     int64
+	b     *big.Int
+	r     *big.Rat
+	scale int
+	f     float64
+}
+
+func toNum(v expr.Expr) (num, bool) {
+	switch v := v.(type) {
+	case expr.Int:
+		return num{kind: intKind, i: v.Value}, true
+	case expr.BigInt:
+		return num{kind: bigKind, b: v.Value}, true
+	case expr.Decimal:
+		return num{kind: decimalKind, r: v.Value, scale: v.Scale}, true
+	case expr.Float:
+		return num{kind: floatKind, f: v.Value}, true
+	}
+	return num{}, false
+}
+
+// to converts n to the kind k, not less than its own.
+func (n num) to(k numKind) num {
+	if n.kind == k {
+		return n
+	}
+	res := num{kind: k, scale: n.scale}
+	switch k {
+	case bigKind:
+		res.b = big.NewInt(n.i)
+	case decimalKind:
+		res.r = n.rat()
+	case floatKind:
+		res.f = n.float()
+	}
+	return res
+}
+
+func (n num) float() float64 {
+	switch n.kind {
+	case intKind:
+		return float64(n.i)
+	case bigKind:
+		f, _ := new(big.Float).SetInt(n.b).Float64()
+		return f
+	case decimalKind:
+		f, _ := n.r.Float64()
+		return f
+	}
+	return n.f
+}
+
+// rat returns the exact value of n, of a float as it prints. It is nil for
+// infinities and NaN.
+func (n num) rat() *big.Rat {
+	switch n.kind {
+	case intKind:
+		return new(big.Rat).SetInt64(n.i)
+	case bigKind:
+		return new(big.Rat).SetInt(n.b)
+	case decimalKind:
+		return n.r
+	}
+	if math.IsInf(n.f, 0) || math.IsNaN(n.f) {
+		return nil
+	}
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(n.f, 'g', -1, 64))
+	return r
+}
+
+func (n num) expr() expr.Expr {
+	switch n.kind {
+	case intKind:
+		return expr.NewInt(n.i)
+	case bigKind:
+		return expr.NewBigInt(n.b)
+	case decimalKind:
+		return expr.NewDecimal(n.r, n.scale)
+	}
+	return expr.NewFloat(n.f)
+}
+
+func numLess(a, b num) bool {
+	if x, y, ok := mixedRats(a, b); ok {
+		return x.Cmp(y) < 0
+	}
+	k := max(a.kind, b.kind)
+	a, b = a.to(k), b.to(k)
+	switch k {
+	case intKind:
+		return a.i < b.i
+	case bigKind:
+		return a.b.Cmp(b.b) < 0
+	case decimalKind:
+		return a.r.Cmp(b.r) < 0
+	}
+	return a.f < b.f
+}
+
+func numEqual(a, b num) bool {
+	if x, y, ok := mixedRats(a, b); ok {
+		return x.Cmp(y) == 0
+	}
+	k := max(a.kind, b.kind)
+	a, b = a.to(k), b.to(k)
+	switch k {
+	case intKind:
+		return a.i == b.i
+	case bigKind:
+		return a.b.Cmp(b.b) == 0
+	case decimalKind:
+		return a.r.Cmp(b.r) == 0
+	}
+	return a.f == b.f
+}
+
+// mixedRats returns the exact values of a and b if one is a float and the
+// other is not, so that a float equals only the number it prints as, like
+// map keys. It is false if either is an infinity or NaN.
+func mixedRats(a, b num) (*big.Rat, *big.Rat, bool) {
+	if a.kind == b.kind || max(a.kind, b.kind) != floatKind {
+		return nil, nil, false
+	}
+	x, y := a.rat(), b.rat()
+	return x, y, x != nil && y != nil
+}
+
+// numCompare returns -1, 0 or 1 as a is less than, equal to or greater than
+// b, false if either is a NaN.
+func numCompare(a, b num) (int, bool) {
+	switch {
+	case numLess(a, b):
+		return -1, true
+	case numLess(b, a):
+		return 1, true
+	case numEqual(a, b):
+		return 0, true
+	}
+	return 0, false
+}
+
+// arithOp is an arithmetic operator, with a function for each kind it keeps.
+// Ints without ints go big, big ints without bigs go decimal. Ints overflow
+// rather than going big, decimals keep the greater scale.
+type arithOp struct {
+	name   string
+	ints   func(a, b int64) (int64, error)
+	bigs   func(a, b *big.Int) (*big.Int, error)
+	rats   func(a, b *big.Rat) (*big.Rat, error)
+	floats func(a, b float64) (float64, error)
+}
+
+func (op arithOp) apply(a, b num) (num, error) {
+	k := max(a.kind, b.kind)
+	if k == intKind && op.ints == nil {
+		k = bigKind
+	}
+	if k == bigKind && op.bigs == nil {
+		k = decimalKind
+	}
+	a, b = a.to(k), b.to(k)
+	res := num{kind: k, scale: max(a.scale, b.scale)}
+	var err error
+	switch k {
+	case intKind:
+		res.i, err = op.ints(a.i, b.i)
+	case bigKind:
+		res.b, err = op.bigs(a.b, b.b)
+	case decimalKind:
+		res.r, err = op.rats(a.r, b.r)
+	default:
+		res.f, err = op.floats(a.f, b.f)
+	}
+	return res, err
+}
+
+// fold applies op from left to right to the operands values[1:].
+func (op arithOp) fold(e Evaluator, values []expr.Expr) (expr.Expr, error) {
+	acc, ok := toNum(values[1])
+	if !ok {
+		return nil, e.error(TypeError, values[1], "unsupported operand for "+op.name+": expect a number")
+	}
+	for _, v := range values[2:] {
+		n, ok := toNum(v)
+		if !ok {
+			return nil, e.error(TypeError, v, "unsupported operand for "+op.name+": expect a number")
+		}
+		var err error
+		if acc, err = op.apply(acc, n); err != nil {
+			return nil, e.error(ArithmeticError, v, err.Error())
+		}
+	}
+	return acc.expr(), nil
+}
+
+var (
+	addOp = arithOp{
+		name: "+",
+		ints: func(a, b int64) (int64, error) {
+			if b > 0 && a > math.MaxInt64-b || b < 0 && a < math.MinInt64-b {
+				return 0, errOverflow
+			}
+			return a + b, nil
+		},
+		bigs:   func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Add(a, b), nil },
+		rats:   func(a, b *big.Rat) (*big.Rat, error) { return new(big.Rat).Add(a, b), nil },
+		floats: func(a, b float64) (float64, error) { return a + b, nil },
+	}
+	subOp = arithOp{
+		name: "-",
+		ints: func(a, b int64) (int64, error) {
+			if b < 0 && a > math.MaxInt64+b || b > 0 && a < math.MinInt64+b {
+				return 0, errOverflow
+			}
+			return a - b, nil
+		},
+		bigs:   func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Sub(a, b), nil },
+		rats:   func(a, b *big.Rat) (*big.Rat, error) { return new(big.Rat).Sub(a, b), nil },
+		floats: func(a, b float64) (float64, error) { return a - b, nil },
+	}
+	mulOp = arithOp{
+		name: "*",
+		ints: func(a, b int64) (int64, error) {
+			if a == 0 || b == 0 {
+				return 0, nil
+			}
+			c := a * b
+			if c/b != a || a == -1 && b == math.MinInt64 || b == -1 && a == math.MinInt64 {
+				return 0, errOverflow
+			}
+			return c, nil
+		},
+		bigs:   func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Mul(a, b), nil },
+		rats:   func(a, b *big.Rat) (*big.Rat, error) { return new(big.Rat).Mul(a, b), nil },
+		floats: func(a, b float64) (float64, error) { return a * b, nil },
+	}
+	divOp = arithOp{
+		name: "/",
+		rats: func(a, b *big.Rat) (*big.Rat, error) {
+			if b.Sign() == 0 {
+				return nil, errDivZero
+			}
+			return new(big.Rat).Quo(a, b), nil
+		},
+		floats: func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivZero
+			}
+			return a / b, nil
+		},
+	}
+	quotOp = arithOp{
+		name: "quot",
+		ints: func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, errDivZero
+			}
+			if a == math.MinInt64 && b == -1 {
+				return 0, errOverflow
+			}
+			return a / b, nil
+		},
+		bigs: func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() == 0 {
+				return nil, errDivZero
+			}
+			return new(big.Int).Quo(a, b), nil
+		},
+		rats: func(a, b *big.Rat) (*big.Rat, error) {
+			if b.Sign() == 0 {
+				return nil, errDivZero
+			}
+			q := new(big.Rat).Quo(a, b)
+			return q.SetInt(new(big.Int).Quo(q.Num(), q.Denom())), nil
+		},
+		floats: func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivZero
+			}
+			return math.Trunc(a / b), nil
+		},
+	}
+	modOp = arithOp{
+		name: "mod",
+		ints: func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, errDivZero
+			}
+			r := a % b
+			if r != 0 && (r < 0) != (b < 0) {
+				r += b
+			}
+			return r, nil
+		},
+		bigs: func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() == 0 {
+				return nil, errDivZero
+			}
+			r := new(big.Int).Rem(a, b)
+			if r.Sign() != 0 && r.Sign() != b.Sign() {
+				r.Add(r, b)
+			}
+			return r, nil
+		},
+		rats: func(a, b *big.Rat) (*big.Rat, error) {
+			if b.Sign() == 0 {
+				return nil, errDivZero
+			}
+			// a - b * floor(a / b), the denominator is positive so Div floors
+			q := new(big.Rat).Quo(a, b)
+			q.SetInt(new(big.Int).Div(q.Num(), q.Denom()))
+			return q.Sub(a, q.Mul(q, b)), nil
+		},
+		floats: func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivZero
+			}
+			r := math.Mod(a, b)
+			if r != 0 && (r < 0) != (b < 0) {
+				r += b
+			}
+			return r, nil
+		},
+	}
+)
+
+func plus(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 3 {
+		return nil, e.error(ArityError, values[0], "need at least two argument")
+	}
+	s, ok := values[1].(expr.String)
+	if !ok {
+		return addOp.fold(e, values)
+	}
+	res := s.Value
+	for i := 2; i < len(values); i++ {
+		switch v := values[i].(type) {
+		case expr.String:
+			res += v.Value
+		case expr.Int, expr.Float, expr.BigInt, expr.Decimal:
+			res += v.String()
+		default:
+			return nil, e.error(TypeError, values[i], "expect string or number")
+		}
+	}
+	return expr.NewString(res), nil
+}
+
+func minus(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 {
+		return nil, e.error(ArityError, values[0], "need at least one argument")
+	}
+	if len(values) == 2 {
+		return subOp.fold(e, []expr.Expr{values[0], expr.NewInt(0), values[1]})
+	}
+	return subOp.fold(e, values)
+}
+
+func multiply(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 3 {
+		return nil, e.error(ArityError, values[0], "need at least 2 argumte")
+	}
+	return mulOp.fold(e, values)
+}
+
+// (/ a b ...) divides as floats if any is a float, else exactly: ints and
+// bigints give an int or a bigint when they divide evenly, a decimal
+// otherwise.
+func divide(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 3 {
+		return nil, e.error(ArityError, values[0], "need at least 2 argumte")
+	}
+	res, err := divOp.fold(e, values)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := res.(expr.Decimal)
+	if !ok || !d.Value.IsInt() {
+		return res, nil
+	}
+	k := intKind
+	for _, v := range values[1:] {
+		n, _ := toNum(v)
+		k = max(k, n.kind)
+	}
+	switch {
+	case k == intKind && d.Value.Num().IsInt64():
+		return expr.NewInt(d.Value.Num().Int64()), nil
+	case k == intKind:
+		return nil, e.error(ArithmeticError, values[len(values)-1], errOverflow.Error())
+	case k == bigKind:
+		return expr.NewBigInt(new(big.Int).Set(d.Value.Num())), nil
+	}
+	return res, nil
+}
+
+// (quot a b) divides truncating toward zero, an integer for integers.
+func quot(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) != 3 {
+		return nil, e.error(ArityError, values[0], "need 2 arguments")
+	}
+	return quotOp.fold(e, values)
+}
+
+// (mod a b) is the remainder of a floored division, with the sign of b.
+func mod(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) != 3 {
+		return nil, e.error(ArityError, values[0], "need 2 arguments")
+	}
+	return modOp.fold(e, values)
+}
+
+// roundModes are the modes of round: half-even, half-up and half-down round
+// to the nearest, breaking ties to even, away from zero or toward zero; up
+// and down round away from and toward zero; ceiling and floor toward
+// positive and negative infinity.
+var roundModes = []string{"half-even", "half-up", "half-down", "up", "down", "ceiling", "floor"}
+
+// roundRat rounds r to places digits after the point, or to a power of ten
+// for negative places.
+func roundRat(r *big.Rat, places int, mode string) *big.Rat {
+	pow := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(places))), nil))
+	scaled := new(big.Rat).Set(r)
+	if places >= 0 {
+		scaled.Mul(scaled, pow)
+	} else {
+		scaled.Quo(scaled, pow)
+	}
+	n := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	frac := new(big.Rat).Sub(scaled, new(big.Rat).SetInt(n))
+	half := new(big.Rat).Abs(frac).Cmp(big.NewRat(1, 2))
+	var away bool
+	switch mode {
+	case "half-even":
+		away = half > 0 || half == 0 && n.Bit(0) == 1
+	case "half-up":
+		away = half >= 0
+	case "half-down":
+		away = half > 0
+	case "up":
+		away = frac.Sign() != 0
+	case "ceiling":
+		away = frac.Sign() > 0
+	case "floor":
+		away = frac.Sign() < 0
+	}
+	if away {
+		n.Add(n, big.NewInt(int64(scaled.Sign())))
+	}
+	res := new(big.Rat).SetInt(n)
+	if places >= 0 {
+		return res.Quo(res, pow)
+	}
+	return res.Mul(res, pow)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// (round x places? mode?) rounds x to places digits after the point, 0 by
+// default, by one of roundModes, half-even by default. Negative places round
+// to tens, hundreds and so on. The result is of the type of x, a decimal
+// prints the places digits.
+func round(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 2 || len(values) > 4 {
+		return nil, e.error(ArityError, values[0], "need 1 to 3 arguments")
+	}
+	n, ok := toNum(values[1])
+	if !ok {
+		return nil, e.error(TypeError, values[1], "expect a number")
+	}
+	places := 0
+	if len(values) > 2 {
+		p, ok := values[2].(expr.Int)
+		if !ok || p.Value < -1000 || p.Value > 1000 {
+			return nil, e.error(TypeError, values[2], "expect an int between -1000 and 1000 for the places")
+		}
+		places = int(p.Value)
+	}
+	mode := "half-even"
+	if len(values) > 3 {
+		m, ok := values[3].(expr.Symbol)
+		if !ok || !slices.Contains(roundModes, m.Value) {
+			return nil, e.error(TypeError, values[3], "expect a rounding mode, one of "+strings.Join(roundModes, ", "))
+		}
+		mode = m.Value
+	}
+	r := n.rat()
+	if r == nil {
+		return values[1], nil
+	}
+	r = roundRat(r, places, mode)
+	switch n.kind {
+	case intKind:
+		if !r.Num().IsInt64() {
+			return nil, e.error(ArithmeticError, values[1], errOverflow.Error())
+		}
+		return expr.NewInt(r.Num().Int64()), nil
+	case bigKind:
+		return expr.NewBigInt(new(big.Int).Set(r.Num())), nil
+	case decimalKind:
+		return expr.NewDecimal(r, max(places, 0)), nil
+	}
+	f, _ := r.Float64()
+	return expr.NewFloat(f), nil
+}
+
+// (decimal x) converts a number, or a string like "12.50", to a decimal. A
+// float converts as it prints, 0.1 to 0.1M.
+func decimal(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) != 2 {
+		return nil, e.error(ArityError, values[0], "need 1 argument")
+	}
+	switch v := values[1].(type) {
+	case expr.Decimal:
+		return v, nil
+	case expr.Float:
+		if math.IsInf(v.Value, 0) || math.IsNaN(v.Value) {
+			return nil, e.error(ArithmeticError, v, "no decimal for "+v.String())
+		}
+		d, _ := expr.ParseDecimal(strconv.FormatFloat(v.Value, 'f', -1, 64))
+		return d, nil
+	case expr.String:
+		d, err := expr.ParseDecimal(v.Value)
+		if err != nil {
+			return nil, e.error(TypeError, v, "malformed decimal: "+v.Value)
+		}
+		return d, nil
+	}
+	n, ok := toNum(values[1])
+	if !ok {
+		return nil, e.error(TypeError, values[1], "expect a number or a string")
+	}
+	return expr.NewDecimal(n.rat(), 0), nil
+}
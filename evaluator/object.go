@@ -0,0 +1,77 @@
+package evaluator
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+// exposure is the set of members of a Go type scripts may access, nil for
+// all exported fields and methods.
+type exposure map[string]bool
+
+// Expose allows scripts run by this evaluator to access values of the type of
+// v with the .. builtin, v is only used for its type. Members are the names
+// of the exported fields and methods allowed, all of them if none is given.
+// Go functions returning values of an exposed type pass them to scripts as
+// objects instead of converting them.
+func (e Evaluator) Expose(v any, members ...string) {
+	var allowed exposure
+	if len(members) > 0 {
+		allowed = exposure{}
+		for _, m := range members {
+			allowed[m] = true
+		}
+	}
+	e.objects[reflect.TypeOf(v)] = allowed
+}
+
+// (.. obj 'Field) reads an exported field, (.. obj 'Method args...) calls an
+// exported method of an object of an exposed type.
+func member(e Evaluator, values ...expr.Expr) (expr.Expr, error) {
+	if len(values) < 3 {
+		return nil, e.error(ArityError, values[0], "need an object and a member name")
+	}
+	obj, ok := values[1].(expr.GoObject)
+	if !ok {
+		return nil, e.error(TypeError, values[1], "expect an object, got", values[1].ExprName())
+	}
+	name, ok := keyName(values[2])
+	if !ok {
+		return nil, e.error(TypeError, values[2], "expect a member name")
+	}
+	v := reflect.ValueOf(obj.Value)
+	allowed, ok := e.objects[v.Type()]
+	if !ok {
+		return nil, e.error(TypeError, values[1], fmt.Sprintf("type %s is not exposed", v.Type()))
+	}
+	if allowed != nil && !allowed[name] {
+		return nil, e.error(NameError, values[2], fmt.Sprintf("member %s of %s is not exposed", name, v.Type()))
+	}
+
+	if m := v.MethodByName(name); m.IsValid() {
+		args := append([]expr.Expr{values[0]}, values[3:]...)
+		return reflectProc(m)(e, args...)
+	}
+	s := v
+	for s.Kind() == reflect.Pointer {
+		if s.IsNil() {
+			return nil, e.error(TypeError, values[1], "nil", v.Type().String())
+		}
+		s = s.Elem()
+	}
+	if s.Kind() == reflect.Struct {
+		if f, ok := s.Type().FieldByName(name); ok && f.IsExported() && len(f.Index) == 1 {
+			if len(values) > 3 {
+				return nil, e.error(ArityError, values[0], "field", name, "takes no arguments")
+			}
+			res, err := e.toLisp(s.Field(f.Index[0]))
+			if err != nil {
+				return nil, e.error(TypeError, values[2], err.Error())
+			}
+			return res, nil
+		}
+	}
+	return nil, e.error(NameError, values[2], fmt.Sprintf("undefined member %s of %s", name, v.Type()))
+}
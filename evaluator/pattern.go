@@ -0,0 +1,297 @@
+package evaluator
+
+import (
+	"strconv"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+// Patterns destructure a value into bindings, in fn and macro parameters,
+// var, let and the clauses of match:
+//
+//	x                  binds x to the value, _ binds nothing
+//	1, "a", nil, 'a    a literal, or a quoted form, equal to the value
+//	(a b & rest)       a list or vector of 2 items or more, rest binds the
+//	                   others as a list or vector
+//	[a [b c]]          the same, nested to any depth
+//	{'sku s "qty" q}   a map with the keys 'sku and "qty", binding their values
+//	(? int? n)         a value the predicate is true of, matching the pattern
+//
+// Map keys are strings, numbers, bools or quoted symbols. Outside match, a
+// value not matching is an error at the pattern.
+
+// predicateHead is the head of a predicate pattern like (? int? n).
+const predicateHead = "?"
+
+// isPattern reports whether e is a pattern destructuring a list, a vector or
+// a map rather than a plain name.
+func isPattern(e expr.Expr) bool {
+	switch e.(type) {
+	case expr.List, expr.Vector, expr.Map:
+		return true
+	}
+	return false
+}
+
+// isLiteral reports whether the pattern p matches a value equal to it.
+func isLiteral(p expr.Expr) bool {
+	switch p := p.(type) {
+	case expr.Int, expr.Float, expr.BigInt, expr.Decimal, expr.String, expr.Bool, expr.Nil:
+		return true
+	case expr.List:
+		return headOf(p) == expr.SF_QUOTE && len(p.Value) == 2
+	}
+	return false
+}
+
+// literal returns the value the literal pattern p matches.
+func literal(p expr.Expr) expr.Expr {
+	if l, ok := p.(expr.List); ok {
+		return l.Value[1]
+	}
+	return p
+}
+
+// patternKey returns the key a map pattern form matches.
+func patternKey(form expr.Expr) (expr.Expr, bool) {
+	if _, ok := form.(expr.Nil); ok || !isLiteral(form) {
+		return nil, false
+	}
+	return literal(form), true
+}
+
+// checkPattern reports a malformed pattern p, or a name bound twice in p or
+// already in names, which it adds the names of p to.
+func (e Evaluator) checkPattern(p expr.Expr, names map[string]bool) error {
+	if isLiteral(p) {
+		return nil
+	}
+	switch pat := p.(type) {
+	case expr.Symbol:
+		if pat.Value == "_" {
+			return nil
+		}
+		if pat.Value == "&" {
+			return e.error(SyntaxError, pat, "expect & before the last pattern of a list or vector")
+		}
+		if names[pat.Value] {
+			return e.error(NameError, pat, "name bound twice:", pat.Value)
+		}
+		names[pat.Value] = true
+		return nil
+	case expr.Map:
+		for _, entry := range pat.Entries() {
+			if _, ok := patternKey(entry.Key); !ok {
+				return e.error(SyntaxError, entry.Key, "expect a string, number, bool or quoted symbol key")
+			}
+			if err := e.checkPattern(entry.Value, names); err != nil {
+				return err
+			}
+		}
+		return nil
+	case expr.List:
+		if headOf(pat) == predicateHead {
+			if len(pat.Value) < 2 || len(pat.Value) > 3 {
+				return e.error(SyntaxError, pat, "expect a predicate and an optional pattern after ?")
+			}
+			if len(pat.Value) == 3 {
+				return e.checkPattern(pat.Value[2], names)
+			}
+			return nil
+		}
+		return e.checkSeqPattern(pat.Value, names)
+	case expr.Vector:
+		return e.checkSeqPattern(pat.Value, names)
+	}
+	return e.error(SyntaxError, p, "expect a symbol, literal, list, vector or map pattern")
+}
+
+func (e Evaluator) checkSeqPattern(items []expr.Expr, names map[string]bool) error {
+	fixed, rest := splitRest(items)
+	for _, item := range fixed {
+		if err := e.checkPattern(item, names); err != nil {
+			return err
+		}
+	}
+	if rest == nil {
+		return nil
+	}
+	if len(rest) != 2 {
+		return e.error(SyntaxError, rest[0], "expect one pattern after &")
+	}
+	return e.checkPattern(rest[1], names)
+}
+
+// splitRest splits the items of a list or vector pattern before &, and from
+// & on, nil if there is none.
+func splitRest(items []expr.Expr) (fixed, rest []expr.Expr) {
+	for i, item := range items {
+		if s, ok := item.(expr.Symbol); ok && s.Value == "&" {
+			return items[:i], items[i:]
+		}
+	}
+	return items, nil
+}
+
+// patternNames returns the symbols p binds.
+func patternNames(p expr.Expr) []expr.Symbol {
+	var res []expr.Symbol
+	var walk func(p expr.Expr)
+	walk = func(p expr.Expr) {
+		if isLiteral(p) {
+			return
+		}
+		switch pat := p.(type) {
+		case expr.Symbol:
+			if pat.Value != "_" && pat.Value != "&" {
+				res = append(res, pat)
+			}
+		case expr.Map:
+			for _, entry := range pat.Entries() {
+				walk(entry.Value)
+			}
+		case expr.List:
+			switch {
+			case headOf(pat) == predicateHead:
+				if len(pat.Value) == 3 {
+					walk(pat.Value[2])
+				}
+			default:
+				for _, item := range pat.Value {
+					walk(item)
+				}
+			}
+		case expr.Vector:
+			for _, item := range pat.Value {
+				walk(item)
+			}
+		}
+	}
+	walk(p)
+	return res
+}
+
+// mismatch is why a value doesn't match a pattern, reported as an error at
+// the pattern outside match.
+type mismatch struct {
+	kind    ErrorKind
+	pattern expr.Expr
+	message []string
+}
+
+// destructure binds the names of the pattern p, checked by checkPattern, to
+// the parts of v they match in the innermost layer of e's environment.
+func (e Evaluator) destructure(p, v expr.Expr) error {
+	m, err := e.bindPattern(p, v)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return e.error(m.kind, m.pattern, m.message...)
+	}
+	return nil
+}
+
+// bindPattern is destructure returning why v doesn't match p instead of an
+// error. Predicates are called in e, seeing the names bound before them.
+func (e Evaluator) bindPattern(p, v expr.Expr) (*mismatch, error) {
+	if v == nil {
+		v = expr.NewNil()
+	}
+	if isLiteral(p) {
+		if !equalValues(literal(p), v) {
+			return &mismatch{TypeError, p, []string{"expect", literal(p).String(), "got", v.String()}}, nil
+		}
+		return nil, nil
+	}
+	switch pat := p.(type) {
+	case expr.Symbol:
+		if pat.Value == "_" {
+			return nil, nil
+		}
+		if !e.env.Add(pat.Value, v) {
+			return nil, e.error(NameError, pat, "already defined:", pat.Value)
+		}
+		return nil, nil
+	case expr.Map:
+		return e.bindMap(pat, v)
+	case expr.List:
+		if headOf(pat) == predicateHead {
+			return e.bindPredicate(pat, v)
+		}
+		return e.bindSeq(pat, pat.Value, v)
+	case expr.Vector:
+		return e.bindSeq(pat, pat.Value, v)
+	}
+	return nil, e.error(SyntaxError, p, "expect a symbol, literal, list, vector or map pattern")
+}
+
+func (e Evaluator) bindSeq(p expr.Expr, pattern []expr.Expr, v expr.Expr) (*mismatch, error) {
+	var items []expr.Expr
+	switch v := v.(type) {
+	case expr.List:
+		items = v.Value
+	case expr.Vector:
+		items = v.Value
+	default:
+		return &mismatch{TypeError, p, []string{"expect a list or vector to destructure, got", v.ExprName()}}, nil
+	}
+	fixed, rest := splitRest(pattern)
+	switch {
+	case rest == nil && len(items) != len(fixed):
+		return &mismatch{ArityError, p, []string{"expect", strconv.Itoa(len(fixed)), "items, got", strconv.Itoa(len(items))}}, nil
+	case len(items) < len(fixed):
+		return &mismatch{ArityError, p, []string{"expect at least", strconv.Itoa(len(fixed)), "items, got", strconv.Itoa(len(items))}}, nil
+	}
+	for i, item := range fixed {
+		if m, err := e.bindPattern(item, items[i]); m != nil || err != nil {
+			return m, err
+		}
+	}
+	if rest == nil {
+		return nil, nil
+	}
+	var others expr.Expr
+	if _, ok := v.(expr.Vector); ok {
+		others = expr.NewVector(items[len(fixed):]...)
+	} else {
+		others = expr.NewList(items[len(fixed):]...)
+	}
+	return e.bindPattern(rest[1], others)
+}
+
+func (e Evaluator) bindMap(p expr.Map, v expr.Expr) (*mismatch, error) {
+	m, ok := v.(expr.Map)
+	if !ok {
+		return &mismatch{TypeError, p, []string{"expect a map to destructure, got", v.ExprName()}}, nil
+	}
+	for _, entry := range p.Entries() {
+		key, _ := patternKey(entry.Key)
+		value, ok := m.Get(key)
+		if !ok {
+			return &mismatch{TypeError, entry.Key, []string{"expect a map with the key", key.String()}}, nil
+		}
+		if m, err := e.bindPattern(entry.Value, value); m != nil || err != nil {
+			return m, err
+		}
+	}
+	return nil, nil
+}
+
+func (e Evaluator) bindPredicate(p expr.List, v expr.Expr) (*mismatch, error) {
+	pred, err := e.Eval(p.Value[1])
+	if err != nil {
+		return nil, err
+	}
+	ok, err := e.call(pred, []expr.Expr{v}, p)
+	if err != nil {
+		return nil, err
+	}
+	if !isTruthy(ok) {
+		return &mismatch{TypeError, p, []string{"expect a value", p.Value[1].String(), "is true of, got", v.String()}}, nil
+	}
+	if len(p.Value) == 3 {
+		return e.bindPattern(p.Value[2], v)
+	}
+	return nil, nil
+}
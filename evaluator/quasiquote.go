@@ -0,0 +1,125 @@
+package evaluator
+
+import "github.com/guiyuanju/golisp/expr"
+
+// quasiquote builds the template e, evaluating the forms unquoted at depth 1.
+// Each nested quasiquote increases the depth and each unquote decreases it,
+// so only the innermost unquotes of the outermost quasiquote are evaluated.
+func (evaluator Evaluator) quasiquote(e expr.Expr, depth int) (expr.Expr, error) {
+	if v, ok := e.(expr.Vector); ok {
+		res, err := evaluator.quasiquoteItems(v.Value, depth, v)
+		if err != nil {
+			return nil, err
+		}
+		return expr.NewVector(res...), nil
+	}
+	if m, ok := e.(expr.Map); ok {
+		res := expr.NewMap()
+		for _, entry := range m.Entries() {
+			k, err := evaluator.quasiquote(entry.Key, depth)
+			if err != nil {
+				return nil, err
+			}
+			v, err := evaluator.quasiquote(entry.Value, depth)
+			if err != nil {
+				return nil, err
+			}
+			res.Value[expr.KeyOf(k)] = expr.MapEntry{Key: k, Value: v}
+		}
+		return res, nil
+	}
+	l, ok := e.(expr.List)
+	if !ok || len(l.Value) == 0 {
+		return e, nil
+	}
+
+	switch headOf(l) {
+	case expr.SF_UNQUOTE:
+		if len(l.Value) != 2 {
+			return nil, evaluator.error(ArityError, l, "expect 1 argument")
+		}
+		if depth == 1 {
+			return evaluator.Eval(l.Value[1])
+		}
+		return evaluator.requote(l, depth-1)
+	case expr.SF_QUASIQUOTE:
+		if len(l.Value) != 2 {
+			return nil, evaluator.error(ArityError, l, "expect 1 argument")
+		}
+		return evaluator.requote(l, depth+1)
+	case expr.SF_UNQUOTE_SPLICING:
+		return nil, evaluator.error(RuntimeError, l, "unquote-splicing outside of a list")
+	}
+
+	res, err := evaluator.quasiquoteItems(l.Value, depth, l)
+	if err != nil {
+		return nil, err
+	}
+	return expr.NewList(res...), nil
+}
+
+// quasiquoteItems builds the elements of the list or vector from, splicing
+// in the lists unquoted with unquote-splicing.
+func (evaluator Evaluator) quasiquoteItems(items []expr.Expr, depth int, from expr.Expr) ([]expr.Expr, error) {
+	res := make([]expr.Expr, 0, len(items))
+	for _, v := range items {
+		sub, ok := v.(expr.List)
+		if !ok || headOf(sub) != expr.SF_UNQUOTE_SPLICING {
+			value, err := evaluator.quasiquote(v, depth)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, value)
+			continue
+		}
+		if len(sub.Value) != 2 {
+			return nil, evaluator.error(ArityError, sub, "expect 1 argument")
+		}
+		if depth > 1 {
+			value, err := evaluator.requote(sub, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, value)
+			continue
+		}
+		value, err := evaluator.Eval(sub.Value[1])
+		if err != nil {
+			return nil, err
+		}
+		switch spliced := value.(type) {
+		case expr.List:
+			res = append(res, spliced.Value...)
+		case expr.Vector:
+			res = append(res, spliced.Value...)
+		default:
+			return nil, evaluator.error(TypeError, sub, "expect unquote-splicing of a list or vector, got", value.ExprName())
+		}
+	}
+	if err := evaluator.checkListSize(len(res), from); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// requote rebuilds the unary form l, e.g. a nested (unquote x), with its
+// argument quasiquoted at depth.
+func (evaluator Evaluator) requote(l expr.List, depth int) (expr.Expr, error) {
+	arg, err := evaluator.quasiquote(l.Value[1], depth)
+	if err != nil {
+		return nil, err
+	}
+	return expr.NewList(l.Value[0], arg), nil
+}
+
+// headOf returns the name of the symbol heading l, or "".
+func headOf(l expr.List) string {
+	if len(l.Value) == 0 {
+		return ""
+	}
+	s, ok := l.Value[0].(expr.Symbol)
+	if !ok {
+		return ""
+	}
+	return s.Value
+}
@@ -0,0 +1,411 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/guiyuanju/golisp/expr"
+)
+
+const ellipsis = "..."
+
+var gensymCounter atomic.Int64
+
+// gensym returns a symbol named after prefix that no other symbol, read from
+// source or generated, can be equal to: its name has braces, which end a
+// symbol in source.
+func gensym(prefix string) expr.Symbol {
+	return expr.NewSymbol(fmt.Sprintf("%s#{%d}", prefix, gensymCounter.Add(1)))
+}
+
+// (syntax-rules name (literal ...) (pattern template) ...)
+func (evaluator Evaluator) defineSyntaxRules(e expr.List) error {
+	if len(e.Value) < 4 {
+		return evaluator.error(ArityError, e, "expect a symbol, a literal list and at least one rule")
+	}
+	name, ok := e.Value[1].(expr.Symbol)
+	if !ok {
+		return evaluator.error(TypeError, e.Value[1], "expect a symbol")
+	}
+	lits, ok := e.Value[2].(expr.List)
+	if !ok {
+		return evaluator.error(TypeError, e.Value[2], "expect a literal list")
+	}
+	literals := []string{}
+	for _, l := range lits.Value {
+		s, ok := l.(expr.Symbol)
+		if !ok {
+			return evaluator.error(TypeError, l, "expect a symbol")
+		}
+		literals = append(literals, s.Value)
+	}
+	rules := []expr.SyntaxRule{}
+	for _, r := range e.Value[3:] {
+		rule, ok := r.(expr.List)
+		if !ok || len(rule.Value) != 2 {
+			return evaluator.error(TypeError, r, "expect a rule (pattern template)")
+		}
+		pattern, ok := rule.Value[0].(expr.List)
+		if !ok || len(pattern.Value) == 0 {
+			return evaluator.error(TypeError, rule.Value[0], "expect a pattern list")
+		}
+		rules = append(rules, expr.SyntaxRule{Pattern: pattern, Template: rule.Value[1]})
+	}
+	if !evaluator.env.Add(name.Value, expr.NewSyntaxMacro(name.Value, literals, rules)) {
+		return evaluator.error(NameError, name, "already defined:", name.Value)
+	}
+	return nil
+}
+
+// patternVar is the form matched by a pattern variable, or, for a variable
+// under an ellipsis, the forms of each repetition.
+type patternVar struct {
+	value expr.Expr
+	items []patternVar
+}
+
+type syntaxMatcher struct {
+	literals map[string]bool
+	vars     map[string]patternVar
+}
+
+// expandRules rewrites e with the first rule of macro whose pattern matches.
+// The head of a pattern is ignored, it stands for the macro name.
+func (evaluator Evaluator) expandRules(macro expr.Macro, e expr.List) (expr.Expr, error) {
+	literals := map[string]bool{}
+	for _, l := range macro.Literals {
+		literals[l] = true
+	}
+	for _, rule := range macro.Rules {
+		pattern := rule.Pattern.(expr.List)
+		m := syntaxMatcher{literals, map[string]patternVar{}}
+		if !m.match(expr.NewList(pattern.Value[1:]...), expr.NewList(e.Value[1:]...)) {
+			continue
+		}
+		t := templater{evaluator, e, renames(rule.Template, m.vars)}
+		return t.expand(rule.Template, m.vars)
+	}
+	return nil, evaluator.error(RuntimeError, e, "no syntax rule of", macro.Name, "matches")
+}
+
+func (m syntaxMatcher) match(pattern, form expr.Expr) bool {
+	switch p := pattern.(type) {
+	case expr.Symbol:
+		if p.Value == "_" {
+			return true
+		}
+		if m.literals[p.Value] {
+			return p.Equal(form)
+		}
+		m.vars[p.Value] = patternVar{value: form}
+		return true
+
+	case expr.List:
+		f, ok := form.(expr.List)
+		return ok && m.matchItems(p.Value, f.Value)
+
+	case expr.Vector:
+		f, ok := form.(expr.Vector)
+		return ok && m.matchItems(p.Value, f.Value)
+
+	default:
+		return pattern.Equal(form)
+	}
+}
+
+// matchItems matches the elements of a list or vector against the patterns
+// ps, of which one may be followed by an ellipsis.
+func (m syntaxMatcher) matchItems(ps, forms []expr.Expr) bool {
+	for i := 0; i < len(ps); i++ {
+		if i+1 < len(ps) && isEllipsis(ps[i+1]) {
+			after := len(ps) - i - 2
+			n := len(forms) - i - after
+			if n < 0 {
+				return false
+			}
+			if !m.matchRepeated(ps[i], forms[i:i+n]) {
+				return false
+			}
+			return m.matchItems(ps[i+2:], forms[i+n:])
+		}
+		if i >= len(forms) || !m.match(ps[i], forms[i]) {
+			return false
+		}
+	}
+	return len(ps) == len(forms)
+}
+
+// matchRepeated matches each form against pattern, binding every variable of
+// pattern to the list of its repetitions.
+func (m syntaxMatcher) matchRepeated(pattern expr.Expr, forms []expr.Expr) bool {
+	names := m.patternVars(pattern, nil)
+	repeated := make(map[string]patternVar, len(names))
+	for _, name := range names {
+		repeated[name] = patternVar{items: []patternVar{}}
+	}
+	for _, f := range forms {
+		sub := syntaxMatcher{m.literals, map[string]patternVar{}}
+		if !sub.match(pattern, f) {
+			return false
+		}
+		for _, name := range names {
+			v := repeated[name]
+			v.items = append(v.items, sub.vars[name])
+			repeated[name] = v
+		}
+	}
+	for name, v := range repeated {
+		m.vars[name] = v
+	}
+	return true
+}
+
+func (m syntaxMatcher) patternVars(pattern expr.Expr, res []string) []string {
+	switch p := pattern.(type) {
+	case expr.Symbol:
+		if p.Value != "_" && p.Value != ellipsis && !m.literals[p.Value] {
+			res = append(res, p.Value)
+		}
+	case expr.List:
+		for _, v := range p.Value {
+			res = m.patternVars(v, res)
+		}
+	case expr.Vector:
+		for _, v := range p.Value {
+			res = m.patternVars(v, res)
+		}
+	}
+	return res
+}
+
+func isEllipsis(e expr.Expr) bool {
+	s, ok := e.(expr.Symbol)
+	return ok && s.Value == ellipsis
+}
+
+// renames returns a fresh symbol for each name the template binds with var,
+// fn, macro, let, catch, match or a loop, so that the bindings introduced by
+// an expansion can't capture or shadow the ones of the code the macro is used
+// in.
+func renames(template expr.Expr, vars map[string]patternVar) map[string]expr.Symbol {
+	res := map[string]expr.Symbol{}
+	bind := func(e expr.Expr) {
+		for _, s := range patternNames(e) {
+			if s.Value == ellipsis {
+				continue
+			}
+			if _, ok := vars[s.Value]; ok {
+				continue
+			}
+			if _, ok := res[s.Value]; !ok {
+				res[s.Value] = gensym(s.Value)
+			}
+		}
+	}
+	bindAll := func(e expr.Expr, step int) {
+		forms := items(e)
+		for i := 0; i < len(forms); i += step {
+			bind(forms[i])
+		}
+	}
+	var walk func(e expr.Expr)
+	walk = func(e expr.Expr) {
+		l, ok := e.(expr.List)
+		if !ok {
+			for _, v := range subforms(e) {
+				walk(v)
+			}
+			return
+		}
+		switch headOf(l) {
+		case expr.SF_VAR:
+			if len(l.Value) > 1 {
+				bind(l.Value[1])
+			}
+		case expr.SF_FN, expr.SF_MACRO:
+			for i := 1; i < len(l.Value) && i < 3; i++ {
+				if _, ok := l.Value[i].(expr.Symbol); !ok {
+					bindAll(l.Value[i], 1)
+					break
+				}
+				bind(l.Value[i])
+			}
+		case "let", expr.SF_LOOP:
+			if len(l.Value) > 1 {
+				bindAll(l.Value[1], 2)
+			}
+		case "catch":
+			if len(l.Value) > 1 {
+				bind(l.Value[1])
+			}
+		case expr.SF_DOTIMES, expr.SF_FOR_EACH:
+			if len(l.Value) > 1 {
+				bindAll(l.Value[1], 2)
+			}
+		case expr.SF_MATCH:
+			for _, c := range l.Value[min(len(l.Value), 2):] {
+				if clause, ok := c.(expr.List); ok && len(clause.Value) > 0 {
+					bind(clause.Value[0])
+				}
+			}
+		case expr.SF_QUOTE:
+			return
+		}
+		for _, v := range l.Value {
+			walk(v)
+		}
+	}
+	walk(template)
+	return res
+}
+
+// items returns the elements of a list or vector, or nil.
+func items(e expr.Expr) []expr.Expr {
+	switch e := e.(type) {
+	case expr.List:
+		return e.Value
+	case expr.Vector:
+		return e.Value
+	}
+	return nil
+}
+
+// isSeq reports whether e is a list or a vector.
+func isSeq(e expr.Expr) bool {
+	switch e.(type) {
+	case expr.List, expr.Vector:
+		return true
+	}
+	return false
+}
+
+// subforms returns the elements of a list or vector, or the keys and values
+// of a map, in the order of keys.
+func subforms(e expr.Expr) []expr.Expr {
+	m, ok := e.(expr.Map)
+	if !ok {
+		return items(e)
+	}
+	res := make([]expr.Expr, 0, 2*m.Len())
+	for _, entry := range m.Entries() {
+		res = append(res, entry.Key, entry.Value)
+	}
+	return res
+}
+
+type templater struct {
+	evaluator Evaluator
+	call      expr.List // the macro call being expanded
+	renames   map[string]expr.Symbol
+}
+
+func (t templater) expand(template expr.Expr, vars map[string]patternVar) (expr.Expr, error) {
+	switch tmpl := template.(type) {
+	case expr.Symbol:
+		if v, ok := vars[tmpl.Value]; ok {
+			if v.items != nil {
+				return nil, t.evaluator.error(RuntimeError, t.call, "pattern variable", tmpl.Value, "used without ellipsis")
+			}
+			return v.value, nil
+		}
+		if s, ok := t.renames[tmpl.Value]; ok {
+			return expr.NewSymbol(s.Value), nil
+		}
+		return tmpl, nil
+
+	case expr.List:
+		res, err := t.expandItems(tmpl.Value, vars)
+		if err != nil {
+			return nil, err
+		}
+		return expr.NewList(res...), nil
+
+	case expr.Vector:
+		res, err := t.expandItems(tmpl.Value, vars)
+		if err != nil {
+			return nil, err
+		}
+		return expr.NewVector(res...), nil
+
+	case expr.Map:
+		res := expr.NewMap()
+		for _, entry := range tmpl.Entries() {
+			k, err := t.expand(entry.Key, vars)
+			if err != nil {
+				return nil, err
+			}
+			v, err := t.expand(entry.Value, vars)
+			if err != nil {
+				return nil, err
+			}
+			res.Value[expr.KeyOf(k)] = expr.MapEntry{Key: k, Value: v}
+		}
+		return res, nil
+
+	default:
+		return template, nil
+	}
+}
+
+func (t templater) expandItems(items []expr.Expr, vars map[string]patternVar) ([]expr.Expr, error) {
+	res := []expr.Expr{}
+	for i := 0; i < len(items); i++ {
+		sub := items[i]
+		if i+1 >= len(items) || !isEllipsis(items[i+1]) {
+			v, err := t.expand(sub, vars)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+			continue
+		}
+		i++
+		repeated, err := t.expandRepeated(sub, vars)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, repeated...)
+	}
+	if err := t.evaluator.checkListSize(len(res), t.call); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// expandRepeated expands template followed by an ellipsis once for each
+// repetition of the pattern variables it uses.
+func (t templater) expandRepeated(template expr.Expr, vars map[string]patternVar) ([]expr.Expr, error) {
+	n := -1
+	var repeated []string
+	for _, name := range (syntaxMatcher{}).patternVars(template, nil) {
+		v, ok := vars[name]
+		if !ok || v.items == nil {
+			continue
+		}
+		if n >= 0 && len(v.items) != n {
+			return nil, t.evaluator.error(RuntimeError, t.call, "pattern variables under ellipsis repeat", strconv.Itoa(n), "and", strconv.Itoa(len(v.items)), "times")
+		}
+		n = len(v.items)
+		repeated = append(repeated, name)
+	}
+	if n < 0 {
+		return nil, t.evaluator.error(RuntimeError, t.call, "ellipsis follows a template without pattern variables to repeat")
+	}
+	res := []expr.Expr{}
+	for i := 0; i < n; i++ {
+		scope := make(map[string]patternVar, len(vars))
+		for k, v := range vars {
+			scope[k] = v
+		}
+		for _, name := range repeated {
+			scope[name] = vars[name].items[i]
+		}
+		v, err := t.expand(template, scope)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
@@ -0,0 +1,117 @@
+package evaluator
+
+import (
+	"errors"
+
+	"github.com/guiyuanju/golisp/expr"
+	"github.com/guiyuanju/golisp/parser"
+)
+
+// (throw message data?) throws a new error, (throw error) rethrows a caught
+// one from where it was first thrown.
+func (evaluator Evaluator) throw(e expr.List) error {
+	if len(e.Value) != 2 && len(e.Value) != 3 {
+		return evaluator.error(ArityError, e, "expect a message and optional data, or an error")
+	}
+	v, err := evaluator.Eval(e.Value[1])
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case expr.Error:
+		if len(e.Value) == 3 {
+			return evaluator.error(ArityError, e, "expect no data with an error")
+		}
+		le := evaluator.error(kindOf(v.Kind), e, v.Message)
+		le.Data = v.Data
+		if v.Line > 0 {
+			le.Position = parser.Position{File: v.File, Line: v.Line, Column: v.Column}
+		}
+		return le
+	case expr.String:
+		le := evaluator.error(ThrownError, e, v.Value)
+		le.Data = expr.NewNil()
+		if len(e.Value) == 3 {
+			data, err := evaluator.Eval(e.Value[2])
+			if err != nil {
+				return err
+			}
+			le.Data = data
+		}
+		return le
+	default:
+		return evaluator.error(TypeError, e.Value[1], "expect a message string or an error, got", v.ExprName())
+	}
+}
+
+// (try body... (catch name handler...) (finally cleanup...)) evaluates body,
+// and on error the handler with the error value bound to name. Cleanup is
+// always evaluated last, an error in it replaces the result. Limit errors
+// can't be caught.
+func (evaluator Evaluator) evalTry(e expr.List) (expr.Expr, error) {
+	var body []expr.Expr
+	var catch, finally *expr.List
+	for i, form := range e.Value[1:] {
+		l, ok := form.(expr.List)
+		clause := ok && (headOf(l) == "catch" || headOf(l) == "finally")
+		if !clause {
+			if catch != nil || finally != nil {
+				return nil, evaluator.error(SyntaxError, form, "expect only catch and finally clauses after the body")
+			}
+			body = e.Value[1 : i+2]
+			continue
+		}
+		switch {
+		case headOf(l) == "catch" && (catch != nil || finally != nil):
+			return nil, evaluator.error(SyntaxError, l, "expect a single catch clause before finally")
+		case headOf(l) == "finally" && finally != nil:
+			return nil, evaluator.error(SyntaxError, l, "expect a single finally clause")
+		case headOf(l) == "catch":
+			if len(l.Value) < 2 {
+				return nil, evaluator.error(ArityError, l, "expect a symbol to bind the error to")
+			}
+			if _, ok := l.Value[1].(expr.Symbol); !ok {
+				return nil, evaluator.error(TypeError, l.Value[1], "expect a symbol")
+			}
+			catch = &l
+		default:
+			finally = &l
+		}
+	}
+	if catch == nil && finally == nil {
+		return nil, evaluator.error(SyntaxError, e, "expect a catch or finally clause")
+	}
+
+	res, err := evaluator.evalBody(body)
+	var le *Error
+	if err != nil && catch != nil && errors.As(err, &le) && le.Kind != LimitError {
+		env := expr.NewEnv()
+		env.Add(catch.Value[1].(expr.Symbol).Value, le.value())
+		handler := evaluator
+		handler.env = evaluator.env.AppendEnv(env)
+		res, err = handler.evalBody(catch.Value[2:])
+	}
+	if finally != nil {
+		if _, ferr := evaluator.evalBody(finally.Value[1:]); ferr != nil {
+			return nil, ferr
+		}
+	}
+	return res, err
+}
+
+// evalBody evaluates forms in order, returning the value of the last one or
+// nil if there is none.
+func (evaluator Evaluator) evalBody(forms []expr.Expr) (expr.Expr, error) {
+	var res expr.Expr
+	for _, form := range forms {
+		v, err := evaluator.Eval(form)
+		if err != nil {
+			return nil, err
+		}
+		res = v
+	}
+	if res == nil {
+		return expr.NewNil(), nil
+	}
+	return res, nil
+}
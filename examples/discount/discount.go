@@ -2,18 +2,19 @@ package main
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/guiyuanju/golisp/evaluator"
 )
 
 func main() {
 	// data is Go side
-	prices := []float64{12, 100, 80, 120, 200, 40, 30}
+	prices := []float64{12, 100, 79.99, 120.45, 200, 40, 30}
 
 	// define a Go function to retrieve data, register it for GoLisp to use
 	evaluator.RegisterBuiltin("get-price-for-order", func(params ...any) (any, error) {
 		// ignoring all error handling
-		return prices[int(params[0].(float64))], nil
+		return prices[params[0].(int64)], nil
 	})
 
 	// define script, can be provided dynamically
@@ -23,12 +24,13 @@ func main() {
 		(fn is-discount-applicable (order)
 			(>= (get-price-for-order order) 100))
 		
+		;; decimals like 0.8M are exact, round to cents
 		(fn apply-percentage-discount (price)
-			(* 0.8 price))
+			(round (* 0.8M price) 2 'half-even))
 
 		;; function defined in script can be invoked from Go side
 		(fn get-discounted-price (order)
-			(let (price (get-price-for-order order))
+			(let (price (decimal (get-price-for-order order)))
 				(if (is-discount-applicable order)
 					(apply-percentage-discount price)
 					price)))
@@ -43,6 +45,6 @@ func main() {
 	// invoke function in script for each order, get discounted price
 	for order := range prices {
 		res, _ := e.InvokeFunc("get-discounted-price", order)
-		fmt.Printf("%v -> %v\n", prices[order], res)
+		fmt.Printf("%v -> %v\n", prices[order], res.(*big.Rat).FloatString(2))
 	}
 }
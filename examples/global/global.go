@@ -10,8 +10,9 @@ func main() {
 	dynamicDiscountRule := "(var a 0)"
 
 	e := evaluator.WithPrelude()
-	_, ok := e.EvalString(dynamicDiscountRule)
-	if !ok {
+	_, err := e.EvalString(dynamicDiscountRule)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
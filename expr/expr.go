@@ -2,7 +2,14 @@ package expr
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 const (
@@ -13,14 +20,27 @@ const (
 	SF_FN    = "fn"
 	SF_MACRO = "macro"
 	SF_APPLY = "apply"
+
+	SF_QUASIQUOTE       = "quasiquote"
+	SF_UNQUOTE          = "unquote"
+	SF_UNQUOTE_SPLICING = "unquote-splicing"
+	SF_SYNTAX_RULES     = "syntax-rules"
+	SF_MODULE           = "module"
+	SF_IMPORT           = "import"
+	SF_THROW            = "throw"
+	SF_TRY              = "try"
+	SF_MATCH            = "match"
+	SF_LOOP             = "loop"
+	SF_RECUR            = "recur"
+	SF_WHILE            = "while"
+	SF_DOTIMES          = "dotimes"
+	SF_FOR_EACH         = "for-each"
 )
 
-var id int
+var id atomic.Int64
 
 func getId() int {
-	res := id
-	id++
-	return res
+	return int(id.Add(1) - 1)
 }
 
 type Expr interface {
@@ -30,27 +50,132 @@ type Expr interface {
 	String() string
 }
 
-type Number struct {
+// Seq is implemented by the ordered collections, List and Vector.
+type Seq interface {
+	Expr
+	Len() int
+	Get(i int) Expr
+	Slice(start, end int) Expr
+	Append(v ...Expr) Expr
+}
+
+// Int is a 64-bit integer.
+type Int struct {
 	Id    int
-	Value float64
+	Value int64
 }
 
-func (e Number) ExprId() int {
+func (e Int) ExprId() int {
 	return e.Id
 }
-func (e Number) ExprName() string {
+func (e Int) ExprName() string {
 	return "int"
 }
-func (e Number) String() string {
-	return fmt.Sprint(e.Value)
+func (e Int) String() string {
+	return strconv.FormatInt(e.Value, 10)
+}
+func (e Int) Equal(other Expr) bool {
+	if o, ok := other.(Int); ok {
+		return e.Value == o.Value
+	}
+	return false
+}
+
+// Float is a 64-bit floating point number, printed with a decimal point or
+// an exponent so it reads back as a float.
+type Float struct {
+	Id    int
+	Value float64
+}
+
+func (e Float) ExprId() int {
+	return e.Id
+}
+func (e Float) ExprName() string {
+	return "float"
+}
+func (e Float) String() string {
+	s := strconv.FormatFloat(e.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
 }
-func (e Number) Equal(other Expr) bool {
-	if o, ok := other.(Number); ok {
+func (e Float) Equal(other Expr) bool {
+	if o, ok := other.(Float); ok {
 		return e.Value == o.Value
 	}
 	return false
 }
 
+// BigInt is an integer of any size, printed with an N suffix like 12N.
+type BigInt struct {
+	Id    int
+	Value *big.Int
+}
+
+func (e BigInt) ExprId() int {
+	return e.Id
+}
+func (e BigInt) ExprName() string {
+	return "bigint"
+}
+func (e BigInt) String() string {
+	return e.Value.String() + "N"
+}
+func (e BigInt) Equal(other Expr) bool {
+	if o, ok := other.(BigInt); ok {
+		return e.Value.Cmp(o.Value) == 0
+	}
+	return false
+}
+
+// Decimal is an exact rational number, written with an M suffix like 12.50M.
+// It prints at least Scale digits after the point, or as a fraction like
+// 1/3M when it has no finite decimal expansion.
+type Decimal struct {
+	Id    int
+	Value *big.Rat
+	Scale int
+}
+
+func (e Decimal) ExprId() int {
+	return e.Id
+}
+func (e Decimal) ExprName() string {
+	return "decimal"
+}
+func (e Decimal) String() string {
+	digits, ok := fractionDigits(e.Value)
+	if !ok {
+		return e.Value.RatString() + "M"
+	}
+	return e.Value.FloatString(max(digits, e.Scale)) + "M"
+}
+func (e Decimal) Equal(other Expr) bool {
+	if o, ok := other.(Decimal); ok {
+		return e.Value.Cmp(o.Value) == 0
+	}
+	return false
+}
+
+// fractionDigits returns the number of digits after the point r needs, false
+// if it has no finite decimal expansion.
+func fractionDigits(r *big.Rat) (int, bool) {
+	d := new(big.Int).Set(r.Denom())
+	twos := int(d.TrailingZeroBits())
+	d.Rsh(d, uint(twos))
+	fives := 0
+	five, m := big.NewInt(5), new(big.Int)
+	for d.Cmp(big.NewInt(1)) != 0 {
+		if d.QuoRem(d, five, m); m.Sign() != 0 {
+			return 0, false
+		}
+		fives++
+	}
+	return max(twos, fives), true
+}
+
 type String struct {
 	Id    int
 	Value string
@@ -138,6 +263,15 @@ type Macro struct {
 	Id      int
 	Name    string
 	Closure Closure
+	// Literals and Rules are set for pattern macros defined by syntax-rules,
+	// which expand by rewriting instead of calling Closure
+	Literals []string
+	Rules    []SyntaxRule
+}
+
+type SyntaxRule struct {
+	Pattern  Expr
+	Template Expr
 }
 
 func (e Macro) ExprId() int {
@@ -153,9 +287,42 @@ func (e Macro) Equal(other Expr) bool {
 	return e.ExprId() == other.ExprId()
 }
 
+// Module is a loaded module, its exported names are looked up in Env.
+type Module struct {
+	Id      int
+	Name    string
+	Path    string
+	Exports []string
+	Env     Env
+}
+
+func (e Module) ExprId() int {
+	return e.Id
+}
+func (e Module) ExprName() string {
+	return "module"
+}
+func (e Module) String() string {
+	return fmt.Sprintf("<module %s>", e.Name)
+}
+func (e Module) Equal(other Expr) bool {
+	o, ok := other.(Module)
+	return ok && e.Path == o.Path
+}
+
+// Get returns the value of the exported name, ok is false if name is not
+// exported.
+func (e Module) Get(name string) (value Expr, ok bool) {
+	if !slices.Contains(e.Exports, name) {
+		return nil, false
+	}
+	return e.Env.Get(name)
+}
+
 type List struct {
 	Id    int
 	Value []Expr
+	end   *atomic.Int64 // see appendSeq
 }
 
 func (e List) ExprId() int {
@@ -189,8 +356,8 @@ func (e List) Len() int {
 	return len(e.Value)
 }
 func (e List) Append(v ...Expr) Expr {
-	newList := append(e.Value, v...)
-	return NewList(newList...)
+	values, end := appendSeq(e.Value, e.end, v)
+	return List{getId(), values, end}
 }
 func (e List) Prepend(v Expr) Expr {
 	newList := []Expr{v}
@@ -205,6 +372,305 @@ func (e List) Get(i int) Expr {
 	return e.Value[i]
 }
 
+// Map is an immutable hash map, operations return a new map.
+type Map struct {
+	Id    int
+	Value map[string]MapEntry // by KeyOf the entry's key
+}
+
+type MapEntry struct {
+	Key   Expr
+	Value Expr
+}
+
+// KeyOf returns the hash key of e. Keys are equal if and only if the values
+// are, numbers of any type if they are by =, like 1, 1.0 and 1.00M.
+func KeyOf(e Expr) string {
+	if n, ok := numKey(e); ok {
+		return "n" + n
+	}
+	return structKey(e)
+}
+
+// numKey returns the exact value of the number e, a float by its shortest
+// decimal form as = compares it.
+func numKey(e Expr) (string, bool) {
+	switch e := e.(type) {
+	case Int:
+		return strconv.FormatInt(e.Value, 10), true
+	case BigInt:
+		return e.Value.String(), true
+	case Decimal:
+		return e.Value.RatString(), true
+	case Float:
+		if math.IsInf(e.Value, 0) || math.IsNaN(e.Value) {
+			return strconv.FormatFloat(e.Value, 'g', -1, 64), true
+		}
+		r, _ := new(big.Rat).SetString(strconv.FormatFloat(e.Value, 'g', -1, 64))
+		return r.RatString(), true
+	}
+	return "", false
+}
+
+// structKey returns the key of e tagged with its type, the numbers in lists,
+// vectors and maps are only equal to numbers of the same type, like Equal.
+func structKey(e Expr) string {
+	switch e := e.(type) {
+	case Int:
+		return "i" + strconv.FormatInt(e.Value, 10)
+	case BigInt:
+		return "N" + e.Value.String()
+	case Float:
+		return "f" + strconv.FormatFloat(e.Value, 'g', -1, 64)
+	case Decimal:
+		return "M" + e.Value.RatString()
+	case String:
+		return "s" + strconv.Quote(e.Value)
+	case Symbol:
+		return "y" + strconv.Quote(e.Value)
+	case Bool:
+		return "b" + strconv.FormatBool(e.Value)
+	case Nil:
+		return "z"
+	case List:
+		return seqKey("(", e.Value, ")")
+	case Vector:
+		return seqKey("[", e.Value, "]")
+	case Map:
+		keys := make([]string, 0, len(e.Value))
+		for k := range e.Value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var sb strings.Builder
+		sb.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(strconv.Quote(k) + " " + structKey(e.Value[k].Value))
+		}
+		sb.WriteString("}")
+		return sb.String()
+	}
+	return e.ExprName() + ":" + strconv.Quote(e.String())
+}
+
+func seqKey(open string, items []Expr, close string) string {
+	var sb strings.Builder
+	sb.WriteString(open)
+	for i, item := range items {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(structKey(item))
+	}
+	sb.WriteString(close)
+	return sb.String()
+}
+
+func (e Map) ExprId() int {
+	return e.Id
+}
+func (e Map) ExprName() string {
+	return "map"
+}
+func (e Map) String() string {
+	var res []string
+	for _, entry := range e.Entries() {
+		res = append(res, fmt.Sprint(entry.Key), fmt.Sprint(entry.Value))
+	}
+	return "{" + strings.Join(res, " ") + "}"
+}
+func (e Map) Equal(other Expr) bool {
+	if o, ok := other.(Map); ok {
+		if len(e.Value) != len(o.Value) {
+			return false
+		}
+		for k, entry := range e.Value {
+			oentry, ok := o.Value[k]
+			if !ok || !entry.Value.Equal(oentry.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+func (e Map) Len() int {
+	return len(e.Value)
+}
+func (e Map) Get(key Expr) (Expr, bool) {
+	entry, ok := e.Value[KeyOf(key)]
+	return entry.Value, ok
+}
+func (e Map) Assoc(key, value Expr) Map {
+	res := e.copy()
+	res.Value[KeyOf(key)] = MapEntry{key, value}
+	return res
+}
+func (e Map) Dissoc(key Expr) Map {
+	res := e.copy()
+	delete(res.Value, KeyOf(key))
+	return res
+}
+func (e Map) copy() Map {
+	res := NewMap()
+	for k, v := range e.Value {
+		res.Value[k] = v
+	}
+	return res
+}
+
+// Entries returns the entries sorted by key, numbers by value, others by KeyOf.
+func (e Map) Entries() []MapEntry {
+	res := make([]MapEntry, 0, len(e.Value))
+	for _, entry := range e.Value {
+		res = append(res, entry)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, aok := numValue(res[i].Key)
+		b, bok := numValue(res[j].Key)
+		if aok && bok {
+			return a < b
+		}
+		return KeyOf(res[i].Key) < KeyOf(res[j].Key)
+	})
+	return res
+}
+
+type Vector struct {
+	Id    int
+	Value []Expr
+	end   *atomic.Int64 // see appendSeq
+}
+
+func (e Vector) ExprId() int {
+	return e.Id
+}
+func (e Vector) ExprName() string {
+	return "vector"
+}
+func (e Vector) String() string {
+	var res []string
+	for _, v := range e.Value {
+		res = append(res, fmt.Sprint(v))
+	}
+	return "[" + strings.Join(res, " ") + "]"
+}
+func (e Vector) Equal(other Expr) bool {
+	if o, ok := other.(Vector); ok {
+		if len(e.Value) != len(o.Value) {
+			return false
+		}
+		for i := range e.Value {
+			if !e.Value[i].Equal(o.Value[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+func (e Vector) Len() int {
+	return len(e.Value)
+}
+func (e Vector) Append(v ...Expr) Expr {
+	values, end := appendSeq(e.Value, e.end, v)
+	return Vector{getId(), values, end}
+}
+func (e Vector) Slice(start, end int) Expr {
+	return NewVector(e.Value[start:end]...)
+}
+func (e Vector) Get(i int) Expr {
+	return e.Value[i]
+}
+
+// appendSeq appends vs to the elements xs of a list or vector without changing
+// the elements of any other value. Values sharing a backing array share end,
+// the length used of the array so far: xs may be extended in place only if
+// it ends there, so appending repeatedly to the latest value is amortized
+// O(1), and appending to an older value copies.
+func appendSeq(xs []Expr, end *atomic.Int64, vs []Expr) ([]Expr, *atomic.Int64) {
+	n := len(xs) + len(vs)
+	if end != nil && n <= cap(xs) && end.CompareAndSwap(int64(len(xs)), int64(n)) {
+		return append(xs, vs...), end
+	}
+	res := make([]Expr, len(xs), max(2*n, 4))
+	copy(res, xs)
+	res = append(res, vs...)
+	end = &atomic.Int64{}
+	end.Store(int64(n))
+	return res, end
+}
+
+// Error is an error value, thrown by throw or by a failing evaluation and
+// caught by try. Kind names the kind of a failing evaluation, e.g. "type
+// error". Go functions called by scripts can return an Error to throw data.
+type Error struct {
+	Id      int
+	Kind    string
+	Message string
+	Data    Expr
+	File    string
+	Line    int
+	Column  int
+}
+
+func (e Error) ExprId() int {
+	return e.Id
+}
+func (e Error) ExprName() string {
+	return "error"
+}
+func (e Error) String() string {
+	return fmt.Sprintf("<error %s>", e.Message)
+}
+func (e Error) Equal(other Expr) bool {
+	return e.ExprId() == other.ExprId()
+}
+func (e Error) Error() string {
+	return e.Message
+}
+
+// GoObject is an opaque handle to a Go value a script can't otherwise
+// represent, it is passed back to Go unchanged.
+type GoObject struct {
+	Id    int
+	Value any
+}
+
+func (e GoObject) ExprId() int {
+	return e.Id
+}
+func (e GoObject) ExprName() string {
+	return "object"
+}
+func (e GoObject) String() string {
+	return fmt.Sprintf("<object %T>", e.Value)
+}
+func (e GoObject) Equal(other Expr) bool {
+	o, ok := other.(GoObject)
+	if !ok {
+		return false
+	}
+	// a comparable type may hold uncomparable values, as interface fields,
+	// which == panics on, slices and maps are the same if they share memory
+	v, w := reflect.ValueOf(e.Value), reflect.ValueOf(o.Value)
+	if !v.IsValid() || !w.IsValid() || v.Type() != w.Type() {
+		return e.ExprId() == o.ExprId()
+	}
+	switch {
+	case v.Comparable() && w.Comparable():
+		return v.Equal(w)
+	case v.Kind() == reflect.Slice:
+		return v.UnsafePointer() == w.UnsafePointer() && v.Len() == w.Len()
+	case v.Kind() == reflect.Map:
+		return v.UnsafePointer() == w.UnsafePointer()
+	}
+	return e.ExprId() == o.ExprId()
+}
+
 type Builtin struct {
 	Id   int
 	Name string
@@ -229,6 +695,10 @@ type Closure struct {
 	Params   []string
 	VarParam string
 	Body     []Expr
+	// Patterns destructure the arguments of the parameters, and last the
+	// list of the variadic ones, nil for those named by a symbol. It is nil
+	// if every parameter is a symbol.
+	Patterns []Expr
 }
 
 func (e Closure) ExprId() int {
@@ -259,8 +729,73 @@ func (e Env) String() string {
 	return sb.String()
 }
 
-func NewNum(value float64) Number {
-	return Number{getId(), value}
+func NewInt(value int64) Int {
+	return Int{getId(), value}
+}
+
+func NewFloat(value float64) Float {
+	return Float{getId(), value}
+}
+
+func NewBigInt(value *big.Int) BigInt {
+	return BigInt{getId(), value}
+}
+
+func NewDecimal(value *big.Rat, scale int) Decimal {
+	return Decimal{getId(), value, scale}
+}
+
+// ParseDecimal parses a decimal number like "12.50" or "-1.5e3", keeping
+// the number of digits written after the point as the scale, or a fraction
+// like "1/3", as decimals without a finite expansion print.
+func ParseDecimal(s string) (Decimal, error) {
+	if n, d, ok := strings.Cut(s, "/"); ok {
+		num, okNum := new(big.Int).SetString(n, 10)
+		den, okDen := new(big.Int).SetString(d, 10)
+		if !okNum || !okDen || den.Sign() <= 0 || strings.HasPrefix(d, "+") {
+			return Decimal{}, &strconv.NumError{Func: "ParseDecimal", Num: s, Err: strconv.ErrSyntax}
+		}
+		return NewDecimal(new(big.Rat).SetFrac(num, den), 0), nil
+	}
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 1 && digits[0] == '0' && strings.ContainsRune("xXbBoO", rune(digits[1])) {
+		return Decimal{}, &strconv.NumError{Func: "ParseDecimal", Num: s, Err: strconv.ErrSyntax}
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return Decimal{}, err
+	}
+	s = strings.ReplaceAll(s, "_", "")
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, &strconv.NumError{Func: "ParseDecimal", Num: s, Err: strconv.ErrSyntax}
+	}
+	mantissa, exp, _ := strings.Cut(strings.ToLower(s), "e")
+	scale := 0
+	if _, frac, ok := strings.Cut(mantissa, "."); ok {
+		scale = len(frac)
+	}
+	if exp != "" {
+		n, _ := strconv.Atoi(exp)
+		scale -= n
+	}
+	return NewDecimal(r, max(scale, 0)), nil
+}
+
+// numValue returns the value of a number as a float64.
+func numValue(e Expr) (float64, bool) {
+	switch e := e.(type) {
+	case Int:
+		return float64(e.Value), true
+	case Float:
+		return e.Value, true
+	case BigInt:
+		f, _ := new(big.Float).SetInt(e.Value).Float64()
+		return f, true
+	case Decimal:
+		f, _ := e.Value.Float64()
+		return f, true
+	}
+	return 0, false
 }
 
 func NewString(value string) String {
@@ -280,7 +815,31 @@ func NewNil() Nil {
 }
 
 func NewList(values ...Expr) List {
-	return List{getId(), values}
+	return List{getId(), values, nil}
+}
+
+func NewVector(values ...Expr) Vector {
+	return Vector{getId(), values, nil}
+}
+
+// NewError returns an error value with the message and data, data may be nil.
+func NewError(message string, data Expr) Error {
+	if data == nil {
+		data = NewNil()
+	}
+	return Error{Id: getId(), Kind: "error", Message: message, Data: data}
+}
+
+func NewGoObject(value any) GoObject {
+	return GoObject{getId(), value}
+}
+
+func NewModule(name, path string, exports []string, env Env) Module {
+	return Module{getId(), name, path, exports, env}
+}
+
+func NewMap() Map {
+	return Map{getId(), map[string]MapEntry{}}
 }
 
 func NewBuiltin(name string) Builtin {
@@ -288,11 +847,15 @@ func NewBuiltin(name string) Builtin {
 }
 
 func NewClosure(env Env, params []string, varparam string, body []Expr) Closure {
-	return Closure{getId(), env, params, varparam, body}
+	return Closure{getId(), env, params, varparam, body, nil}
 }
 
 func NewMacro(name string, closure Closure) Macro {
-	return Macro{getId(), name, closure}
+	return Macro{Id: getId(), Name: name, Closure: closure}
+}
+
+func NewSyntaxMacro(name string, literals []string, rules []SyntaxRule) Macro {
+	return Macro{Id: getId(), Name: name, Literals: literals, Rules: rules}
 }
 
 func NewEnv() Env {
@@ -345,13 +908,50 @@ func (e Env) AppendEnv(env Env) Env {
 	if len(env) > 1 {
 		panic("AppendEnv only allow append env with length 1")
 	}
-	return append(e, env[0])
+	// clip so that envs extending the same parent never share a backing array
+	return append(e[:len(e):len(e)], env[0])
 }
 
-// GoLisp value -> Go value
+// keyName returns the name a string or symbol map key converts to.
+func keyName(k Expr) (string, bool) {
+	switch k := k.(type) {
+	case String:
+		return k.Value, true
+	case Symbol:
+		return k.Value, true
+	}
+	return "", false
+}
+
+// mapByKeyOf converts a map whose keys are not all distinct names, keyed by
+// KeyOf so that keys like 1 and "1" stay apart.
+func mapByKeyOf(m Map, other func(Expr) any) map[string]any {
+	res := make(map[string]any, len(m.Value))
+	for k, entry := range m.Value {
+		res[k] = GValFunc(entry.Value, other)
+	}
+	return res
+}
+
+// GoLisp value -> Go value, values without a Go representation, like
+// closures, are returned as is. A map is keyed by the names of its string and
+// symbol keys, or if it has other keys or a string and a symbol of the same
+// name, by KeyOf.
 func GVal(val Expr) any {
+	return GValFunc(val, func(v Expr) any { return v })
+}
+
+// GValFunc is GVal with other converting the values without a Go
+// representation.
+func GValFunc(val Expr, other func(Expr) any) any {
 	switch val := val.(type) {
-	case Number:
+	case Int:
+		return val.Value
+	case Float:
+		return val.Value
+	case BigInt:
+		return val.Value
+	case Decimal:
 		return val.Value
 	case String:
 		return val.Value
@@ -364,23 +964,79 @@ func GVal(val Expr) any {
 	case List:
 		res := []any{}
 		for _, v := range val.Value {
-			res = append(res, GVal(v))
+			res = append(res, GValFunc(v, other))
+		}
+		return res
+	case Vector:
+		res := []any{}
+		for _, v := range val.Value {
+			res = append(res, GValFunc(v, other))
+		}
+		return res
+	case GoObject:
+		return val.Value
+	case Map:
+		res := map[string]any{}
+		for _, entry := range val.Value {
+			name, ok := keyName(entry.Key)
+			if _, taken := res[name]; !ok || taken {
+				return mapByKeyOf(val, other)
+			}
+			res[name] = GValFunc(entry.Value, other)
 		}
 		return res
 	default:
-		panic(fmt.Sprintf("%T cannot be converted from GoLisp value", val))
+		return other(val)
 	}
 }
 
+// uintVal converts an unsigned integer, to a BigInt beyond the range of Int.
+func uintVal(v uint64) Expr {
+	if v > math.MaxInt64 {
+		return NewBigInt(new(big.Int).SetUint64(v))
+	}
+	return NewInt(int64(v))
+}
+
 // Go value -> GoLisp value
 func LVal(val any) Expr {
 	switch val := val.(type) {
+	case Expr:
+		return val
 	case int:
-		return NewNum(float64(val))
+		return NewInt(int64(val))
+	case int8:
+		return NewInt(int64(val))
+	case int16:
+		return NewInt(int64(val))
+	case int32:
+		return NewInt(int64(val))
+	case int64:
+		return NewInt(val)
+	case uint:
+		return uintVal(uint64(val))
+	case uint8:
+		return NewInt(int64(val))
+	case uint16:
+		return NewInt(int64(val))
+	case uint32:
+		return NewInt(int64(val))
+	case uint64:
+		return uintVal(val)
 	case float32:
-		return NewNum(float64(val))
+		return NewFloat(float64(val))
 	case float64:
-		return NewNum(float64(val))
+		return NewFloat(val)
+	case *big.Int:
+		if val == nil {
+			return NewNil()
+		}
+		return NewBigInt(new(big.Int).Set(val))
+	case *big.Rat:
+		if val == nil {
+			return NewNil()
+		}
+		return NewDecimal(new(big.Rat).Set(val), 0)
 	case string:
 		if len(val) > 0 && val[0] == '\'' {
 			return NewSymbol(val)
@@ -394,6 +1050,12 @@ func LVal(val any) Expr {
 			res = append(res, LVal(v))
 		}
 		return NewList(res...)
+	case []int64:
+		var res []Expr
+		for _, v := range val {
+			res = append(res, LVal(v))
+		}
+		return NewList(res...)
 	case []float32:
 		var res []Expr
 		for _, v := range val {
@@ -424,9 +1086,22 @@ func LVal(val any) Expr {
 			res = append(res, LVal(v))
 		}
 		return NewList(res...)
+	case []any:
+		var res []Expr
+		for _, v := range val {
+			res = append(res, LVal(v))
+		}
+		return NewList(res...)
+	case map[string]any:
+		res := NewMap()
+		for k, v := range val {
+			key := NewString(k)
+			res.Value[KeyOf(key)] = MapEntry{key, LVal(v)}
+		}
+		return res
 	case nil:
 		return NewNil()
 	default:
-		panic(fmt.Sprintf("%T cannot be converted to GoLisp value", val))
+		return NewGoObject(val)
 	}
 }
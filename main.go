@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"os"
 
 	"github.com/guiyuanju/golisp/evaluator"
@@ -10,6 +10,9 @@ import (
 
 func main() {
 	e := evaluator.WithPrelude()
+	e.OnWarning(func(w *evaluator.Error) {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	})
 
 	args := os.Args[1:]
 	if len(args) == 0 {
@@ -17,13 +20,9 @@ func main() {
 		return
 	}
 
-	filename := args[0]
-	code, err := os.ReadFile(filename)
+	_, err := e.EvalFile(args[0])
 	if err != nil {
-		log.Fatal(err)
-	}
-	_, ok := e.EvalString(string(code))
-	if !ok {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,17 @@
+package parser
+
+// Error is a syntax error reported by the scanner or the parser.
+type Error struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return Position{File: e.File, Line: e.Line, Column: e.Column}.String() + ": " + e.Message
+}
+
+func newError(file string, line, column int, message string) *Error {
+	return &Error{file, line, column, message}
+}
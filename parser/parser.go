@@ -1,7 +1,7 @@
 package parser
 
 import (
-	"fmt"
+	"math/big"
 
 	"github.com/guiyuanju/golisp/expr"
 )
@@ -9,6 +9,7 @@ import (
 type Parser struct {
 	i         int
 	tokens    []Token
+	File      string // the file name recorded in positions and errors
 	Positions Positions
 }
 
@@ -33,84 +34,164 @@ func (p *Parser) isEnd() bool {
 }
 
 func (p *Parser) withPosOfToken(expr expr.Expr, token Token) expr.Expr {
-	pos := Position{token.Line, token.Column}
-	p.Positions[expr.ExprId()] = pos
+	return p.withRange(expr, token, token)
+}
+
+// withPos records the position of expr, from the token start to the last
+// token read.
+func (p *Parser) withPos(expr expr.Expr, start Token) expr.Expr {
+	return p.withRange(expr, start, p.previous())
+}
+
+func (p *Parser) withRange(expr expr.Expr, start, end Token) expr.Expr {
+	p.Positions[expr.ExprId()] = Position{
+		File:      p.File,
+		Line:      start.Line,
+		Column:    start.Column,
+		EndLine:   end.EndLine,
+		EndColumn: end.EndColumn,
+		Offset:    start.Offset,
+		End:       end.Offset + end.Length,
+	}
 	return expr
 }
 
-func (p *Parser) expr() (expr.Expr, bool) {
+func (p *Parser) expr() (expr.Expr, error) {
 	if p.isEnd() {
-		fmt.Println(errorInfo(p.previous(), "expect a expr after it"))
-		return nil, false
+		return nil, p.error(p.previous(), "expect a expr after it")
 	}
 	cur := p.cur()
 	switch cur.TokenType {
 	case NUMBER:
 		p.advance()
-		return p.withPosOfToken(expr.NewNum(cur.Value.(float64)), cur), true
+		switch v := cur.Value.(type) {
+		case int64:
+			return p.withPosOfToken(expr.NewInt(v), cur), nil
+		case *big.Int:
+			return p.withPosOfToken(expr.NewBigInt(v), cur), nil
+		case expr.Decimal:
+			return p.withPosOfToken(v, cur), nil
+		}
+		return p.withPosOfToken(expr.NewFloat(cur.Value.(float64)), cur), nil
 	case STRING:
 		p.advance()
-		return p.withPosOfToken(expr.NewString(cur.Value.(string)), cur), true
+		return p.withPosOfToken(expr.NewString(cur.Value.(string)), cur), nil
 	case TRUE:
 		p.advance()
-		return p.withPosOfToken(expr.NewBool(true), cur), true
+		return p.withPosOfToken(expr.NewBool(true), cur), nil
 	case FALSE:
 		p.advance()
-		return p.withPosOfToken(expr.NewBool(false), cur), true
+		return p.withPosOfToken(expr.NewBool(false), cur), nil
 	case NIL:
 		p.advance()
-		return p.withPosOfToken(expr.NewNil(), cur), true
+		return p.withPosOfToken(expr.NewNil(), cur), nil
 	case SYMBOL:
 		p.advance()
-		return p.withPosOfToken(expr.NewSymbol(cur.Value.(string)), cur), true
+		return p.withPosOfToken(expr.NewSymbol(cur.Value.(string)), cur), nil
 	case QUOTE:
 		p.advance()
-		v, ok := p.expr()
-		if !ok {
-			return nil, false
-		}
-		return expr.NewList(expr.NewSymbol(expr.SF_QUOTE), v), true
-	case LEFT_PAREN:
-		res, ok := p.list()
-		if !ok {
-			return nil, false
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
 		}
-		_, ok = p.consume(RIGHT_PAREN)
-		if !ok {
-			return nil, false
+		return p.withPos(expr.NewList(p.withPosOfToken(expr.NewSymbol(expr.SF_QUOTE), cur), v), cur), nil
+	case QUASIQUOTE, UNQUOTE, UNQUOTE_SPLICING:
+		p.advance()
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
 		}
-		return res, true
+		name := map[TokenType]string{
+			QUASIQUOTE:       expr.SF_QUASIQUOTE,
+			UNQUOTE:          expr.SF_UNQUOTE,
+			UNQUOTE_SPLICING: expr.SF_UNQUOTE_SPLICING,
+		}[cur.TokenType]
+		return p.withPos(expr.NewList(p.withPosOfToken(expr.NewSymbol(name), cur), v), cur), nil
+	case LEFT_BRACE:
+		return p.hashMap()
+	case LEFT_BRACKET:
+		return p.vector()
+	case LEFT_PAREN:
+		return p.list()
 	}
-	fmt.Println(errorInfo(cur, "unexpected token"))
-	return nil, false
+	return nil, p.error(cur, "unexpected token")
 }
 
-func (p *Parser) list() (expr.Expr, bool) {
-	p.advance()
+func (p *Parser) list() (expr.Expr, error) {
 	cur := p.cur()
+	p.advance()
 	var res []expr.Expr
 	for !p.isEnd() && p.cur().TokenType != RIGHT_PAREN {
-		expr, ok := p.expr()
-		if !ok {
-			return nil, false
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
 		}
 		res = append(res, expr)
 	}
-	return p.withPosOfToken(expr.NewList(res...), cur), true
+	if _, err := p.consume(RIGHT_PAREN); err != nil {
+		return nil, err
+	}
+	return p.withPos(expr.NewList(res...), cur), nil
+}
+
+// hashMap reads {k v ...} as a map of the forms k to the forms v, evaluated
+// like the items of a vector. A key form may appear once.
+func (p *Parser) hashMap() (expr.Expr, error) {
+	cur := p.cur()
+	p.advance()
+	res := expr.NewMap()
+	for !p.isEnd() && p.cur().TokenType != RIGHT_BRACE {
+		keyToken := p.cur()
+		k, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.isEnd() || p.cur().TokenType == RIGHT_BRACE {
+			return nil, p.error(cur, "expect an even number of forms in map literal")
+		}
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		key := expr.KeyOf(k)
+		if _, ok := res.Value[key]; ok {
+			return nil, p.error(keyToken, "duplicate key in map literal")
+		}
+		res.Value[key] = expr.MapEntry{Key: k, Value: v}
+	}
+	if _, err := p.consume(RIGHT_BRACE); err != nil {
+		return nil, err
+	}
+	return p.withPos(res, cur), nil
+}
+
+func (p *Parser) vector() (expr.Expr, error) {
+	cur := p.cur()
+	p.advance()
+	var res []expr.Expr
+	for !p.isEnd() && p.cur().TokenType != RIGHT_BRACKET {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if _, err := p.consume(RIGHT_BRACKET); err != nil {
+		return nil, err
+	}
+	return p.withPos(expr.NewVector(res...), cur), nil
 }
 
-func (p *Parser) consume(tokenType TokenType) (Token, bool) {
+func (p *Parser) consume(tokenType TokenType) (Token, error) {
 	if p.isEnd() {
-		fmt.Println(errorInfo(p.previous(), "unexpected end"))
-		return Token{}, false
+		return Token{}, p.error(p.previous(), "unexpected end")
 	}
 	if p.cur().TokenType != tokenType {
-		fmt.Println(errorInfo(p.cur(), "unexpected token"))
-		return Token{}, false
+		return Token{}, p.error(p.cur(), "unexpected token")
 	}
 	cur := p.cur()
 	p.advance()
-	return cur, true
+	return cur, nil
 }
 
 func (p *Parser) previous() Token {
@@ -120,18 +201,18 @@ func (p *Parser) previous() Token {
 	return p.tokens[p.i-1]
 }
 
-func errorInfo(token Token, info string) string {
-	return fmt.Sprintf("repl:%d:%d: %s", token.Line, token.Column, info)
+func (p *Parser) error(token Token, info string) *Error {
+	return newError(p.File, token.Line, token.Column, info)
 }
 
-func (p *Parser) Parse() ([]expr.Expr, bool) {
+func (p *Parser) Parse() ([]expr.Expr, error) {
 	var res []expr.Expr
 	for !p.isEnd() {
-		e, ok := p.expr()
-		if !ok {
-			return nil, false
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
 		}
 		res = append(res, e)
 	}
-	return res, true
+	return res, nil
 }
@@ -3,6 +3,8 @@ package parser
 import (
 	"fmt"
 	"testing"
+
+	"github.com/guiyuanju/golisp/expr"
 )
 
 func TestParse(t *testing.T) {
@@ -25,6 +27,45 @@ func TestParse(t *testing.T) {
 	}
 
 	p := New(tokens)
-	res, ok := p.Parse()
-	fmt.Println(res, ok)
+	res, err := p.Parse()
+	fmt.Println(res, err)
+}
+
+func TestParsePosition(t *testing.T) {
+	s := NewScanner("(var a\n  [1 \"b\"]) 'c")
+	tokens, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(tokens)
+	p.File = "a.gl"
+	res, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := res[0].(expr.List)
+	cases := []struct {
+		name   string
+		expr   expr.Expr
+		expect Position
+	}{
+		{"list", list, Position{"a.gl", 1, 1, 2, 11, 0, 17}},
+		{"vector", list.Value[2], Position{"a.gl", 2, 3, 2, 10, 9, 16}},
+		{"string", list.Value[2].(expr.Vector).Value[1], Position{"a.gl", 2, 6, 2, 9, 12, 15}},
+		{"quote", res[1], Position{"a.gl", 2, 12, 2, 14, 18, 20}},
+	}
+	for _, c := range cases {
+		if pos := p.Positions[c.expr.ExprId()]; pos != c.expect {
+			t.Errorf("%s: expect %#v, got %#v", c.name, c.expect, pos)
+		}
+	}
+}
+
+func TestParseErrorFile(t *testing.T) {
+	p := New([]Token{NewToken(RIGHT_PAREN, 2, 3, 1, nil)})
+	p.File = "a.gl"
+	_, err := p.Parse()
+	if err == nil || err.Error() != "a.gl:2:3: unexpected token" {
+		t.Fatalf("expect a.gl:2:3: unexpected token, got %v", err)
+	}
 }
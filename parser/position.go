@@ -1,7 +1,23 @@
 package parser
 
+import "fmt"
+
+// Position is the source range of an expression, from Line and Column to
+// just before EndLine and EndColumn, or from byte Offset to End.
 type Position struct {
-	Line, Column int
+	File               string
+	Line, Column       int
+	EndLine, EndColumn int
+	Offset, End        int
+}
+
+// String formats the start of p as file:line:column, without the file if
+// it is unnamed.
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
 type Positions map[int]Position
@@ -1,8 +1,16 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/guiyuanju/golisp/expr"
 )
 
 type TokenType int
@@ -17,28 +25,59 @@ const (
 	NIL
 	SYMBOL
 	QUOTE
+	QUASIQUOTE
+	UNQUOTE
+	UNQUOTE_SPLICING
+	LEFT_BRACE
+	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 )
 
-var DELIMETER []byte = []byte{'(', ')', '{', '}', ' ', '\n', '"'}
+// DELIMETER ends a symbol or a literal, as does any white space.
+var DELIMETER []rune = []rune{'(', ')', '{', '}', '[', ']', ' ', '\n', '"'}
+
+func isDelimiter(r rune) bool {
+	return slices.Contains(DELIMETER, r) || unicode.IsSpace(r)
+}
 
+// Token is a lexeme starting at Line and Column, Offset is its byte offset
+// in the source and Length its length in bytes. EndLine and EndColumn are the
+// position just after it.
 type Token struct {
 	TokenType TokenType
 	Line      int
 	Column    int
 	Length    int
 	Value     any
+	Offset    int
+	EndLine   int
+	EndColumn int
 }
 
 func NewToken(tokenType TokenType, line, column, length int, value any) Token {
-	return Token{tokenType, line, column, length, value}
+	return Token{
+		TokenType: tokenType,
+		Line:      line,
+		Column:    column,
+		Length:    length,
+		Value:     value,
+		EndLine:   line,
+		EndColumn: column + length,
+	}
 }
 
+// Scanner reads tokens from UTF-8 source. Offsets and lengths are in bytes,
+// columns count runes.
 type Scanner struct {
+	File   string // the file name reported in errors
 	s      []byte
 	i      int // current parsing index
 	line   int // current parsing line
-	column int // current parsing column in current line
-	length int // length of current parsing token
+	column int // current parsing column in current line, in runes
+
+	// where the current token starts
+	start, startLine, startColumn int
 }
 
 func NewScanner(s string) Scanner {
@@ -47,18 +86,37 @@ func NewScanner(s string) Scanner {
 		i:      0,
 		line:   1,
 		column: 1,
-		length: 0,
 	}
 }
 
+// begin starts a token at the current position.
+func (s *Scanner) begin() {
+	s.start, s.startLine, s.startColumn = s.i, s.line, s.column
+}
+
+// newToken returns the token from the last begin to the current position.
 func (s *Scanner) newToken(tokenType TokenType, value any) Token {
-	res := NewToken(tokenType, s.line, s.column-s.length, s.length, value)
-	s.length = 0
-	return res
+	return Token{
+		TokenType: tokenType,
+		Line:      s.startLine,
+		Column:    s.startColumn,
+		Length:    s.i - s.start,
+		Value:     value,
+		Offset:    s.start,
+		EndLine:   s.line,
+		EndColumn: s.column,
+	}
+}
+
+// single scans a one rune token.
+func (s *Scanner) single(tokenType TokenType) Token {
+	s.advance()
+	return s.newToken(tokenType, nil)
 }
 
-func (s *Scanner) cur() byte {
-	return s.s[s.i]
+func (s *Scanner) cur() rune {
+	r, _ := utf8.DecodeRune(s.s[s.i:])
+	return r
 }
 
 func (s *Scanner) isEnd() bool {
@@ -66,95 +124,143 @@ func (s *Scanner) isEnd() bool {
 }
 
 func (s *Scanner) advance() {
-	s.i++
+	_, n := utf8.DecodeRune(s.s[s.i:])
+	s.i += n
 	s.column++
 }
 
+// newline advances past a line feed.
+func (s *Scanner) newline() {
+	s.line++
+	s.column = 0
+	s.advance()
+}
+
 func (s *Scanner) consume(value string) bool {
-	start := s.i
+	start, column := s.i, s.column
 	reset := func() {
 		s.i = start
-		s.length = 0
+		s.column = column
 	}
-	for _, b := range []byte(value) {
-		if s.isEnd() || b != s.cur() {
+	for _, r := range value {
+		if s.isEnd() || r != s.cur() {
 			reset()
 			return false
 		}
 		s.advance()
-		s.length++
 	}
-	if !s.isEnd() && !slices.Contains(DELIMETER, s.cur()) {
+	if !s.isEnd() && !isDelimiter(s.cur()) {
 		reset()
 		return false
 	}
 	return true
 }
 
-func (s *Scanner) errorInfo(info string) string {
-	return fmt.Sprintf("repl:%d:%d: %s", s.line, s.column, info)
+func (s *Scanner) error(info string) *Error {
+	return newError(s.File, s.line, s.column, info)
 }
 
-func (s *Scanner) Scan() ([]Token, bool) {
+func (s *Scanner) Scan() ([]Token, error) {
+	if err := s.checkUTF8(); err != nil {
+		return nil, err
+	}
 	var res []Token
 	for !s.isEnd() {
+		s.begin()
 		switch s.cur() {
 		case '\n':
-			s.line++
-			s.column = 0
-			s.advance()
+			s.newline()
 		case ' ', '\t':
 			s.advance()
 		case ';':
 			s.comment()
 		case '(':
-			res = append(res, s.newToken(LEFT_PAREN, nil))
-			s.advance()
+			res = append(res, s.single(LEFT_PAREN))
 		case ')':
-			res = append(res, s.newToken(RIGHT_PAREN, nil))
-			s.advance()
+			res = append(res, s.single(RIGHT_PAREN))
+		case '{':
+			res = append(res, s.single(LEFT_BRACE))
+		case '}':
+			res = append(res, s.single(RIGHT_BRACE))
+		case '[':
+			res = append(res, s.single(LEFT_BRACKET))
+		case ']':
+			res = append(res, s.single(RIGHT_BRACKET))
 		case '\'':
-			res = append(res, s.newToken(QUOTE, nil))
-			s.advance()
+			res = append(res, s.single(QUOTE))
+		case '`':
+			res = append(res, s.single(QUASIQUOTE))
+		case ',':
+			if next, ok := s.peek(1); ok && next == '@' {
+				s.advance()
+				res = append(res, s.single(UNQUOTE_SPLICING))
+				break
+			}
+			res = append(res, s.single(UNQUOTE))
 		case '"':
-			v, ok := s.string()
-			if !ok {
-				return nil, false
+			v, err := s.string()
+			if err != nil {
+				return nil, err
 			}
 			res = append(res, s.newToken(STRING, v))
 		default:
-			if s.consume("true") {
+			if unicode.IsSpace(s.cur()) {
+				s.advance()
+			} else if next, ok := s.peek(1); ok && s.cur() == '#' && next == '"' {
+				v, err := s.rawString()
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, s.newToken(STRING, v))
+			} else if s.consume("true") {
 				res = append(res, s.newToken(TRUE, nil))
 			} else if s.consume("false") {
 				res = append(res, s.newToken(FALSE, nil))
 			} else if s.consume("nil") {
 				res = append(res, s.newToken(NIL, nil))
+			} else if v, ok := s.special(); ok {
+				res = append(res, s.newToken(NUMBER, v))
 			} else if s.isNumber() {
-				res = append(res, s.newToken(NUMBER, s.number()))
+				v, err := s.number()
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, s.newToken(NUMBER, v))
 			} else {
 				res = append(res, s.newToken(SYMBOL, s.symbol()))
 			}
 		}
 	}
-	return res, true
+	return res, nil
 }
 
+// special scans the float literals Inf, +Inf, -Inf and NaN, spelled as Go
+// prints them. Other spellings strconv accepts, like inf or nan, are symbols.
+func (s *Scanner) special() (float64, bool) {
+	for _, lit := range []string{"Inf", "+Inf", "-Inf", "NaN"} {
+		if s.consume(lit) {
+			v, _ := strconv.ParseFloat(lit, 64)
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// isNumber reports whether a number starts at the current rune: a digit, or
+// a dot or a sign followed by one, or a sign and a dot followed by one.
 func (s *Scanner) isNumber() bool {
 	if s.isEnd() {
 		return false
 	}
-	c := s.cur()
-	if isDigit(c) {
-		return true
+	i := 0
+	if c := s.cur(); c == '-' || c == '+' {
+		i++
 	}
-	if c == '-' {
-		next, ok := s.peek(1)
-		if !ok {
-			return false
-		}
-		return isDigit(next)
+	if c, ok := s.peek(i); ok && c == '.' {
+		i++
 	}
-	return false
+	c, ok := s.peek(i)
+	return ok && isDigit(c)
 }
 
 func (s *Scanner) comment() {
@@ -163,71 +269,189 @@ func (s *Scanner) comment() {
 	}
 }
 
-func isDigit(x byte) bool {
+func isDigit(x rune) bool {
 	return '0' <= x && x <= '9'
 }
 
-func (s *Scanner) peek(i int) (byte, bool) {
-	if s.i+i >= len(s.s) {
+// peek returns the rune i runes after the current one.
+func (s *Scanner) peek(i int) (rune, bool) {
+	j := s.i
+	for ; i > 0 && j < len(s.s); i-- {
+		_, n := utf8.DecodeRune(s.s[j:])
+		j += n
+	}
+	if j >= len(s.s) {
 		return 0, false
 	}
-	return s.s[s.i+i], true
+	r, _ := utf8.DecodeRune(s.s[j:])
+	return r, true
+}
+
+// checkUTF8 reports the first byte of the source that isn't valid UTF-8.
+func (s *Scanner) checkUTF8() error {
+	line, column := 1, 1
+	for i := 0; i < len(s.s); {
+		r, n := utf8.DecodeRune(s.s[i:])
+		if r == utf8.RuneError && n == 1 {
+			return newError(s.File, line, column, fmt.Sprintf("invalid UTF-8 byte %#x at offset %d", s.s[i], i))
+		}
+		if r == '\n' {
+			line, column = line+1, 0
+		}
+		column++
+		i += n
+	}
+	return nil
 }
 
 func (s *Scanner) symbol() string {
-	var res []byte
-	for !s.isEnd() && !slices.Contains(DELIMETER, s.cur()) {
-		res = append(res, s.cur())
+	var sb strings.Builder
+	for !s.isEnd() && !isDelimiter(s.cur()) {
+		sb.WriteRune(s.cur())
 		s.advance()
-		s.length++
 	}
-	return string(res)
+	return sb.String()
 }
 
-func (s *Scanner) string() (string, bool) {
-	var res []byte
+// string scans a string literal, which may span lines. Escapes are those of
+// Go's interpreted string literals, like \n, \" and \u00e9.
+func (s *Scanner) string() (string, error) {
+	var sb strings.Builder
 	s.advance()
-	s.length++
-	for !s.isEnd() && s.cur() != '"' && s.cur() != '\n' {
-		res = append(res, s.cur())
-		s.advance()
-		s.length++
-	}
-	if !s.consume("\"") {
-		fmt.Println(s.errorInfo("expect \""))
-		return "", false
+	for !s.isEnd() && s.cur() != '"' {
+		switch s.cur() {
+		case '\n':
+			sb.WriteByte('\n')
+			s.newline()
+		case '\\':
+			if err := s.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteRune(s.cur())
+			s.advance()
+		}
 	}
-	s.length++
-	return string(res), true
+	return sb.String(), s.close("\"")
 }
 
-func (s *Scanner) number() float64 {
-	var isNeg bool
-	if s.cur() == '-' {
-		isNeg = true
-		s.advance()
+// escape scans the escape sequence at the current backslash into sb.
+func (s *Scanner) escape(sb *strings.Builder) error {
+	// an escape is at most \U and 8 hex digits
+	seq := string(s.s[s.i:min(s.i+10, len(s.s))])
+	v, multibyte, tail, err := strconv.UnquoteChar(seq, '"')
+	if err != nil {
+		_, n := utf8.DecodeRuneInString(seq[1:])
+		return s.error(fmt.Sprintf("invalid escape sequence %s", seq[:1+n]))
 	}
-	var res float64
-	for !s.isEnd() && isDigit(s.cur()) {
-		res = res*10 + float64(s.cur()-'0')
-		s.advance()
-		s.length++
+	// \x and octal escapes are bytes
+	if multibyte {
+		sb.WriteRune(v)
+	} else {
+		sb.WriteByte(byte(v))
 	}
-	var decimal float64
-	if !s.isEnd() && s.cur() == '.' {
+	for range len(seq) - len(tail) {
 		s.advance()
-		pos := 10.0
-		for !s.isEnd() && isDigit(s.cur()) {
-			cur := float64(s.cur() - '0')
-			decimal += cur / pos
+	}
+	return nil
+}
+
+// rawString scans a raw string literal #"..."#, which may span lines and
+// contain quotes, without escapes.
+func (s *Scanner) rawString() (string, error) {
+	s.advance()
+	s.advance()
+	start := s.i
+	for !s.isEnd() {
+		if next, ok := s.peek(1); ok && s.cur() == '"' && next == '#' {
+			break
+		}
+		if s.cur() == '\n' {
+			s.newline()
+		} else {
 			s.advance()
-			pos *= 10
 		}
 	}
-	res += decimal
+	v := string(s.s[start:s.i])
+	return v, s.close("\"#")
+}
 
-	if isNeg {
-		return -res
+// close consumes the closing quote of the string that began the token.
+func (s *Scanner) close(quote string) error {
+	if s.isEnd() {
+		return s.error(fmt.Sprintf("expect %s to close the string at %d:%d", quote, s.startLine, s.startColumn))
+	}
+	if !s.consume(quote) {
+		s.i += len(quote)
+		s.column += len(quote)
+		return s.error("expect a delimiter after the string")
 	}
-	return res
+	return nil
+}
+
+// number scans a numeric literal like Go's: 12, +5, -0.5, .5, 1., 1e6,
+// 1_000_000, 0xFF, 0b1010, 0o17 or 0x1p-2. The literal runs to the next
+// delimiter, so 1.2.3 is an error rather than several tokens. Its value is
+// an int64, a *big.Int if it doesn't fit or ends with N like 12N, an
+// expr.Decimal if it ends with M like 12.50M, or a float64 if it has a
+// fraction or an exponent.
+func (s *Scanner) number() (any, error) {
+	text := s.symbol()
+	var v any
+	var err error
+	switch lit := text[:len(text)-1]; {
+	case strings.HasSuffix(text, "M"):
+		v, err = expr.ParseDecimal(lit)
+	case strings.HasSuffix(text, "N"):
+		v, err = parseBigInt(lit)
+	default:
+		v, err = parseNumber(text)
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, newError(s.File, s.startLine, s.startColumn, "number out of range: "+text)
+	}
+	if err != nil {
+		return 0, newError(s.File, s.startLine, s.startColumn, "malformed number: "+text)
+	}
+	return v, nil
+}
+
+// parseNumber parses an integer as an int64, or a *big.Int out of its
+// range, and other numbers as a float64.
+func parseNumber(text string) (any, error) {
+	digits := strings.TrimLeft(text, "+-")
+	if isPrefixed(digits) && !strings.ContainsAny(digits, ".pP") || !isPrefixed(digits) && !strings.ContainsAny(digits, ".eE") {
+		n, err := parseBigInt(text)
+		if err != nil {
+			return nil, err
+		}
+		if n.IsInt64() {
+			return n.Int64(), nil
+		}
+		return n, nil
+	}
+	return strconv.ParseFloat(text, 64)
+}
+
+// parseBigInt parses an integer of any size, in base 10 even with leading
+// zeros unless prefixed like 0x.
+func parseBigInt(text string) (*big.Int, error) {
+	base := 0
+	if !isPrefixed(strings.TrimLeft(text, "+-")) {
+		// validated as a float for the placement of underscores
+		_, err := strconv.ParseFloat(text, 64)
+		if strings.ContainsAny(text, ".eE") || err != nil && !errors.Is(err, strconv.ErrRange) {
+			return nil, strconv.ErrSyntax
+		}
+		text, base = strings.ReplaceAll(text, "_", ""), 10
+	}
+	n, ok := new(big.Int).SetString(text, base)
+	if !ok {
+		return nil, strconv.ErrSyntax
+	}
+	return n, nil
+}
+
+func isPrefixed(digits string) bool {
+	return len(digits) > 1 && digits[0] == '0' && strings.ContainsRune("xXbBoO", rune(digits[1]))
 }
@@ -1,23 +1,147 @@
 package parser
 
 import (
+	"fmt"
+	"math"
 	"testing"
 )
 
 func TestScanNumber(t *testing.T) {
 	s := NewScanner("123")
-	ts, ok := s.Scan()
-	if !ok || ts[0].Value.(float64) != 123.0 {
+	ts, err := s.Scan()
+	if err != nil || ts[0].Value.(int64) != 123 {
 		t.Error("expect 123, got", ts[0].Value)
 	}
 
 	s = NewScanner("10.01")
-	ts, ok = s.Scan()
-	if !ok || ts[0].Value.(float64) != 10.01 {
+	ts, err = s.Scan()
+	if err != nil || ts[0].Value.(float64) != 10.01 {
 		t.Error("expect 10.01, got", ts[0].Value)
 	}
 }
 
+func TestScanNumberLiterals(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect any
+	}{
+		{"0.15", 0.15},
+		{"+5", int64(5)},
+		{"-5", int64(-5)},
+		{".5", 0.5},
+		{"-.5", -0.5},
+		{"1.", 1.0},
+		{"1e6", 1e6},
+		{"2.5E-3", 2.5e-3},
+		{"1_000_000", int64(1000000)},
+		{"0xFF", int64(255)},
+		{"-0x10", int64(-16)},
+		{"0b1010", int64(10)},
+		{"0o17", int64(15)},
+		{"0x1p-2", 0.25},
+		{"9007199254740993", int64(9007199254740993)},
+		{"-9223372036854775808", int64(-9223372036854775808)},
+	}
+	for _, c := range cases {
+		s := NewScanner(c.input)
+		ts, err := s.Scan()
+		if err != nil {
+			t.Fatalf("%s: %v", c.input, err)
+		}
+		if len(ts) != 1 || ts[0].TokenType != NUMBER || ts[0].Value != c.expect {
+			t.Errorf("%s: expect %v, got %v", c.input, c.expect, ts)
+		}
+	}
+
+	specials := []struct {
+		input  string
+		expect float64
+	}{
+		{"Inf", math.Inf(1)},
+		{"+Inf", math.Inf(1)},
+		{"-Inf", math.Inf(-1)},
+		{"NaN", math.NaN()},
+	}
+	for _, c := range specials {
+		s := NewScanner(c.input)
+		ts, err := s.Scan()
+		if err != nil || len(ts) != 1 || ts[0].TokenType != NUMBER {
+			t.Fatalf("%s: expect a number, got %v, %v", c.input, ts, err)
+		}
+		if v := ts[0].Value.(float64); v != c.expect && !(math.IsNaN(v) && math.IsNaN(c.expect)) {
+			t.Errorf("%s: expect %v, got %v", c.input, c.expect, v)
+		}
+	}
+
+	for _, input := range []string{"+", "-", ".", "...", "-x", "+a", "inf", "nan", "Infinity", "NaNs", "-Info"} {
+		s := NewScanner(input)
+		ts, err := s.Scan()
+		if err != nil || len(ts) != 1 || ts[0].TokenType != SYMBOL {
+			t.Errorf("%s: expect a symbol, got %v, %v", input, ts, err)
+		}
+	}
+}
+
+func TestScanBigNumbers(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"-0x1_0000_0000_0000_0000", "-18446744073709551616"},
+		{"12N", "12"},
+		{"0xFFN", "255"},
+		{"12.50M", "12.50M"},
+		{"-0.15M", "-0.15M"},
+		{"1_000M", "1000M"},
+		{"1.5e2M", "150M"},
+		{"2.5e-3M", "0.0025M"},
+		{"1/3M", "1/3M"},
+		{"-2/4M", "-0.5M"},
+	}
+	for _, c := range cases {
+		s := NewScanner(c.input)
+		ts, err := s.Scan()
+		if err != nil {
+			t.Fatalf("%s: %v", c.input, err)
+		}
+		if len(ts) != 1 || ts[0].TokenType != NUMBER || fmt.Sprint(ts[0].Value) != c.expect {
+			t.Errorf("%s: expect %v, got %v", c.input, c.expect, ts)
+		}
+	}
+}
+
+func TestScanMalformedNumber(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{"(+ 1.2.3 1)", "1:4: malformed number: 1.2.3"},
+		{"1__0", "1:1: malformed number: 1__0"},
+		{"1e", "1:1: malformed number: 1e"},
+		{"12abc", "1:1: malformed number: 12abc"},
+		{"0x1.8", "1:1: malformed number: 0x1.8"},
+		{"1e400", "1:1: number out of range: 1e400"},
+		{"1.5N", "1:1: malformed number: 1.5N"},
+		{"0x10M", "1:1: malformed number: 0x10M"},
+		{"1eM", "1:1: malformed number: 1eM"},
+		{"1e400M", "1:1: number out of range: 1e400M"},
+		{"1/0M", "1:1: malformed number: 1/0M"},
+		{"1/-3M", "1:1: malformed number: 1/-3M"},
+		{"1/+3M", "1:1: malformed number: 1/+3M"},
+		{"1/3/4M", "1:1: malformed number: 1/3/4M"},
+		{"1.5/3M", "1:1: malformed number: 1.5/3M"},
+		{"1/3", "1:1: malformed number: 1/3"},
+	}
+	for _, c := range cases {
+		s := NewScanner(c.input)
+		_, err := s.Scan()
+		if err == nil || err.Error() != c.expect {
+			t.Errorf("%s: expect %s, got %v", c.input, c.expect, err)
+		}
+	}
+}
+
 func TestScanString(t *testing.T) {
 	str := "\"this is a string\""
 	s := NewScanner(str)
@@ -47,15 +171,18 @@ func TestScanComplex(t *testing.T) {
 		{"number", "123", []TokenType{NUMBER}},
 		{"string", "\"a string\"", []TokenType{STRING}},
 		{"true", "true", []TokenType{TRUE}},
+		{"map", "{a 1}", []TokenType{LEFT_BRACE, SYMBOL, NUMBER, RIGHT_BRACE}},
+		{"vector", "[a 1]", []TokenType{LEFT_BRACKET, SYMBOL, NUMBER, RIGHT_BRACKET}},
+		{"quasiquote", "`(a ,b ,@c)", []TokenType{QUASIQUOTE, LEFT_PAREN, SYMBOL, UNQUOTE, SYMBOL, UNQUOTE_SPLICING, SYMBOL, RIGHT_PAREN}},
 		{"complex", "(if true (set a (+ a 1)) b)",
 			[]TokenType{LEFT_PAREN, SYMBOL, TRUE, LEFT_PAREN, SYMBOL, SYMBOL, LEFT_PAREN,
 				SYMBOL, SYMBOL, NUMBER, RIGHT_PAREN, RIGHT_PAREN, SYMBOL, RIGHT_PAREN}},
 	}
 	for _, tc := range cases {
 		s := NewScanner(tc.input)
-		res, ok := s.Scan()
-		if !ok {
-			t.Fatal("scan failed at", tc.name)
+		res, err := s.Scan()
+		if err != nil {
+			t.Fatal("scan failed at", tc.name, err)
 		}
 		if len(res) != len(tc.expect) {
 			t.Fatal("scan failed at", tc.name, "lenght not equal")
@@ -73,11 +200,121 @@ func TestScanPosition(t *testing.T) {
 	s := NewScanner(str)
 	res, _ := s.Scan()
 	one := res[2]
-	if !(one.Value.(float64) == 1.0 && one.Line == 1 && one.Column == 4) {
+	if !(one.Value.(int64) == 1 && one.Line == 1 && one.Column == 4) {
 		t.Error("postion info of 1 incorrect", one)
 	}
 	twoThree := res[3]
-	if !(twoThree.Value.(float64) == 23.0 && twoThree.Line == 2 && twoThree.Column == 4 && twoThree.Length == 2) {
+	if !(twoThree.Value.(int64) == 23 && twoThree.Line == 2 && twoThree.Column == 4 && twoThree.Length == 2) {
 		t.Error("postion info of 2 incorrect", twoThree)
 	}
 }
+
+func TestScanStringEscapes(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"quote", `"say \"hi\""`, `say "hi"`},
+		{"controls", `"a\tb\nc\\"`, "a\tb\nc\\"},
+		{"unicode", `"caf\u00e9 \U0001F600"`, "café 😀"},
+		{"bytes", `"\x41\101"`, "AA"},
+		{"multi-line", "\"a\n  b\"", "a\n  b"},
+		{"raw", `#"C:\dir "quoted""#`, `C:\dir "quoted"`},
+		{"raw multi-line", "#\"a\n\\n\"#", "a\n\\n"},
+	}
+	for _, c := range cases {
+		s := NewScanner(c.input)
+		ts, err := s.Scan()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(ts) != 1 || ts[0].TokenType != STRING || ts[0].Value.(string) != c.expect {
+			t.Fatalf("%s: expect string %q, got %v", c.name, c.expect, ts)
+		}
+	}
+}
+
+func TestScanStringPosition(t *testing.T) {
+	s := NewScanner("(f \"a\\\"b\n c\" x)")
+	ts, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	str, x := ts[2], ts[3]
+	if str.Line != 1 || str.Column != 4 || str.EndLine != 2 || str.EndColumn != 4 || str.Offset != 3 || str.Length != 9 {
+		t.Errorf("position of the string incorrect: %+v", str)
+	}
+	if x.Line != 2 || x.Column != 5 || x.Offset != 13 {
+		t.Errorf("position after the string incorrect: %+v", x)
+	}
+}
+
+func TestScanStringError(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"unknown escape", `"a \q"`, `1:4: invalid escape sequence \q`},
+		{"short unicode", `"\u12"`, `1:2: invalid escape sequence \u`},
+		{"surrogate", `"\uD800"`, `1:2: invalid escape sequence \u`},
+		{"unterminated", "(f \"a\nb", `2:2: expect " to close the string at 1:4`},
+		{"unterminated raw", `#"a"`, `1:5: expect "# to close the string at 1:1`},
+		{"no delimiter", `"a"b`, "1:4: expect a delimiter after the string"},
+	}
+	for _, c := range cases {
+		s := NewScanner(c.input)
+		_, err := s.Scan()
+		if err == nil || err.Error() != c.expect {
+			t.Errorf("%s: expect %s, got %v", c.name, c.expect, err)
+		}
+	}
+}
+
+func TestScanUnicode(t *testing.T) {
+	s := NewScanner("(价格 \"café 😀\" x　é)")
+	ts, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		value                             any
+		column, endColumn, offset, length int
+	}{
+		{nil, 1, 2, 0, 1},
+		{"价格", 2, 4, 1, 6},
+		{"café 😀", 5, 13, 8, 12},
+		{"x", 14, 15, 22, 1},
+		{"é", 16, 17, 26, 2},
+		{nil, 17, 18, 28, 1},
+	}
+	if len(ts) != len(expect) {
+		t.Fatalf("expect %d tokens, got %v", len(expect), ts)
+	}
+	for i, e := range expect {
+		tk := ts[i]
+		if tk.Value != e.value || tk.Column != e.column || tk.EndColumn != e.endColumn || tk.Offset != e.offset || tk.Length != e.length {
+			t.Errorf("token %d: expect %+v, got %+v", i, e, tk)
+		}
+	}
+}
+
+func TestScanInvalidUTF8(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"symbol", "(a\nbé\xff)", "2:3: invalid UTF-8 byte 0xff at offset 6"},
+		{"string", "\"\xc3\"", "1:2: invalid UTF-8 byte 0xc3 at offset 1"},
+		{"escape", `"\é"`, `1:2: invalid escape sequence \é`},
+	}
+	for _, c := range cases {
+		s := NewScanner(c.input)
+		_, err := s.Scan()
+		if err == nil || err.Error() != c.expect {
+			t.Errorf("%s: expect %s, got %v", c.name, c.expect, err)
+		}
+	}
+}
@@ -19,22 +19,27 @@ func Repl(e evaluator.Evaluator) {
 		line := scanner.Text()
 
 		s := parser.NewScanner(line)
-		tokens, ok := s.Scan()
-		if !ok {
+		s.File = "repl"
+		tokens, err := s.Scan()
+		if err != nil {
+			fmt.Println(err)
 			continue
 		}
 
 		p := parser.New(tokens)
-		exprs, ok := p.Parse()
-		if !ok {
+		p.File = "repl"
+		p.Positions = e.Positions
+		exprs, err := p.Parse()
+		if err != nil {
+			fmt.Println(err)
 			continue
 		}
 
-		e.Positions = p.Positions
 		for _, expr := range exprs {
-			res, ok := e.Eval(expr)
-			if !ok {
-				continue
+			res, err := e.Eval(expr)
+			if err != nil {
+				fmt.Println(err)
+				break
 			}
 			fmt.Println(res)
 		}
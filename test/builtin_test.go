@@ -0,0 +1,140 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/guiyuanju/golisp/evaluator"
+	"github.com/guiyuanju/golisp/expr"
+)
+
+func constant(v any) func(...any) (any, error) {
+	return func(...any) (any, error) {
+		return v, nil
+	}
+}
+
+func TestEvaluatorRegister(t *testing.T) {
+	a := evaluator.New()
+	b := evaluator.New()
+	a.Register("tenant", constant("a"))
+	b.Register("tenant", constant("b"))
+
+	res, err := a.EvalString("(tenant)")
+	if err != nil || res.String() != "a" {
+		t.Fatalf("expect a, got %v, %v", res, err)
+	}
+	res, err = b.EvalString("(tenant)")
+	if err != nil || res.String() != "b" {
+		t.Fatalf("expect b, got %v, %v", res, err)
+	}
+
+	c := evaluator.New()
+	_, err = c.EvalString("(tenant)")
+	var le *evaluator.Error
+	if !errors.As(err, &le) || le.Kind != evaluator.NameError {
+		t.Fatalf("expect name error, got %v", err)
+	}
+}
+
+func TestEvaluatorUnregister(t *testing.T) {
+	e := evaluator.New()
+	e.Register("secret", constant(1))
+	if _, err := e.EvalString("(var f secret)"); err != nil {
+		t.Fatal(err)
+	}
+	e.Unregister("secret")
+	e.Unregister("print")
+	for _, code := range []string{"(secret)", "(f)", "(print 1)"} {
+		_, err := e.EvalString(code)
+		var le *evaluator.Error
+		if !errors.As(err, &le) || le.Kind != evaluator.NameError {
+			t.Fatalf("%s: expect name error, got %v", code, err)
+		}
+	}
+}
+
+func TestComposeBuiltins(t *testing.T) {
+	pricing := evaluator.Builtins{}
+	pricing.Register("rate", constant(0.8))
+	pricing.Register("currency", constant("EUR"))
+	override := evaluator.Builtins{}
+	override.Register("currency", constant("USD"))
+
+	e := evaluator.NewWith(evaluator.Compose(pricing, override))
+	res, err := e.EvalString("(+ (currency) (rate))")
+	if err != nil || res.String() != "USD0.8" {
+		t.Fatalf("expect USD0.8, got %v, %v", res, err)
+	}
+
+	// registering on an evaluator doesn't leak into the shared set
+	e.Register("rate", constant(1))
+	other := evaluator.NewWith(pricing)
+	res, err = other.EvalString("(rate)")
+	if err != nil || res.String() != "0.8" {
+		t.Fatalf("expect 0.8, got %v, %v", res, err)
+	}
+}
+
+func TestGlobalRegistryConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			evaluator.RegisterBuiltin("global-constant", constant(1))
+		}()
+		go func() {
+			defer wg.Done()
+			e := evaluator.New()
+			if _, err := e.EvalString("(+ 1 2)"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGensymUnreadable(t *testing.T) {
+	e := evaluator.New()
+	g, err := e.EvalString("(var g (gensym 'x)) g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the digits of the generated name, spelled as a source symbol
+	digits := strings.TrimFunc(g.String(), func(r rune) bool { return r < '0' || r > '9' })
+	for _, spelling := range []string{"x#" + digits, "x" + digits, g.String()} {
+		res, err := e.EvalString("(= g '" + spelling + ")")
+		if err == nil && res.String() != "false" {
+			t.Fatalf("expect %s read from source not to equal %v", spelling, g)
+		}
+	}
+}
+
+func TestMatchGoNil(t *testing.T) {
+	e := evaluator.New()
+	e.RegisterProc("nothing", func(evaluator.Evaluator, ...expr.Expr) (expr.Expr, error) {
+		return nil, nil
+	})
+	var warnings []*evaluator.Error
+	e.OnWarning(func(w *evaluator.Error) {
+		warnings = append(warnings, w)
+	})
+	cases := []testCase{
+		{"literal", "(match (nothing) (nil 'none) (_ 'some))", "none"},
+		{"mismatch", "(match (nothing) (1 'one) ([a] a) ((? int?) 'int) (_ 'other))", "other"},
+		{"no clause", "(match (nothing) (1 'one))", "nil"},
+		{"destructure", "(try (var [a] (nothing)) (catch e (error-kind e)))", "type error"},
+	}
+	for _, c := range cases {
+		res, err := e.EvalString(c.code)
+		if err != nil || res.String() != c.expect {
+			t.Fatalf("%s: expect %s, got %v, %v", c.name, c.expect, res, err)
+		}
+	}
+	if len(warnings) != 1 || warnings[0].Message != "no clause matches nil" {
+		t.Fatalf("expect a warning for nil, got %v", warnings)
+	}
+}
@@ -0,0 +1,336 @@
+package test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/guiyuanju/golisp/evaluator"
+	"github.com/guiyuanju/golisp/expr"
+	"github.com/guiyuanju/golisp/parser"
+)
+
+func TestErrors(t *testing.T) {
+	type errorCase struct {
+		name   string
+		code   string
+		kind   evaluator.ErrorKind
+		line   int
+		column int
+	}
+	cases := []errorCase{
+		{"undefined", "(var a 1)\n(+ a b)", evaluator.NameError, 2, 6},
+		{"redefine", "(var a 1) (var a 2)", evaluator.NameError, 1, 16},
+		{"type", "(- 1 \"a\")", evaluator.TypeError, 1, 6},
+		{"arity", "(fn f (x y) x) (f 1)", evaluator.ArityError, 1, 16},
+		{"index", "(. 3 (list 1 2))", evaluator.IndexError, 1, 4},
+		{"builtin arity", "(list 1)\n(+ 1)", evaluator.ArityError, 2, 1},
+		{"builtin argument", "(list 1)\n(len (+ 1 2))", evaluator.TypeError, 2, 6},
+		{"builtin map argument", "(list 1)\n(get (+ 1 2) 'k)", evaluator.TypeError, 2, 6},
+		{"not callable", "(1 2)", evaluator.TypeError, 1, 2},
+		{"syntax", "(+ 1 \"abc", evaluator.SyntaxError, 1, 10},
+		{"unquote outside", "(var x 1) ,x", evaluator.RuntimeError, 1, 11},
+		{"splicing non list", "`(1 ,@2)", evaluator.TypeError, 1, 5},
+		{"odd map literal", "{'a 1 'b}", evaluator.SyntaxError, 1, 1},
+		{"duplicate map key", "{'a 1\n 'a 2}", evaluator.SyntaxError, 2, 2},
+		{"get non map", "(get 1 'a)", evaluator.TypeError, 1, 6},
+		{"no rule", "(syntax-rules one () ((_ a) a))\n(one 1 2)", evaluator.RuntimeError, 2, 1},
+		{"uncaught throw", "(fn f () (throw \"boom\"))\n(f)", evaluator.ThrownError, 1, 10},
+		{"rethrow keeps origin", "(fn f () (throw \"boom\"))\n(try (f) (catch e (throw e)))", evaluator.ThrownError, 1, 10},
+		{"try without clause", "(try 1)", evaluator.SyntaxError, 1, 1},
+		{"body after catch", "(try 1 (catch e 2) 3)", evaluator.SyntaxError, 1, 20},
+		{"unicode columns", "(var 价格 \"é\")\n(- 1 价格)", evaluator.TypeError, 1, 9},
+		{"invalid utf-8", "(var a \"\xff\")", evaluator.SyntaxError, 1, 9},
+		{"malformed number", "(var a 1)\n(+ a 1.2.3)", evaluator.SyntaxError, 2, 6},
+		{"int overflow", "(* 9223372036854775807 2)", evaluator.ArithmeticError, 1, 24},
+		{"negate min int", "(- -9223372036854775808)", evaluator.ArithmeticError, 1, 4},
+		{"division by zero", "(/ 1 0)", evaluator.ArithmeticError, 1, 6},
+		{"mod by zero", "(mod 1 0.0)", evaluator.ArithmeticError, 1, 8},
+		{"float index", "(. 1.5 (list 1 2))", evaluator.TypeError, 1, 4},
+		{"decimal division by zero", "(/ 1M 0)", evaluator.ArithmeticError, 1, 7},
+		{"round mode", "(round 1.5M 0 'nearest)", evaluator.TypeError, 1, 16},
+		{"round int overflow", "(round 9223372036854775807 -1)", evaluator.ArithmeticError, 1, 8},
+		{"malformed decimal", "(decimal \"1.2.3\")", evaluator.TypeError, 1, 10},
+		{"pattern length", "(fn f ([a b]) a)\n(f (list 1))", evaluator.ArityError, 1, 8},
+		{"nested pattern length", "(var [a [b c]] (list 1 (list 2 3 4)))", evaluator.ArityError, 1, 9},
+		{"pattern rest length", "(var (a b & c) (list 1))", evaluator.ArityError, 1, 6},
+		{"pattern type", "(var [a b] 1)", evaluator.TypeError, 1, 6},
+		{"map pattern key", "(var {'a a} {'b 1})", evaluator.TypeError, 1, 7},
+		{"map pattern type", "(var {'a a} [1])", evaluator.TypeError, 1, 6},
+		{"pattern name twice", "(fn f ([a a]) a)", evaluator.NameError, 1, 11},
+		{"pattern rest", "(var [a & b c] (list 1))", evaluator.SyntaxError, 1, 9},
+		{"pattern key", "(var {b b} {})", evaluator.SyntaxError, 1, 7},
+		{"match clause", "(match 1 2)", evaluator.SyntaxError, 1, 10},
+		{"match guard", "(match 1 (x :when))", evaluator.SyntaxError, 1, 13},
+		{"match pattern", "(match 1 ([a a] a))", evaluator.NameError, 1, 14},
+		{"match predicate", "(match 1 ((? undefined) 1))", evaluator.NameError, 1, 14},
+		{"match in body", "(match [1] ([a] (+ a \"b\")))", evaluator.TypeError, 1, 22},
+		{"recur not in tail", "(loop (i 0) (+ 1 (recur i)))", evaluator.SyntaxError, 1, 18},
+		{"recur in fn", "(loop (i 0) (fn (x) (recur x)))", evaluator.SyntaxError, 1, 21},
+		{"recur in try", "(loop (i 0) (try (recur i)))", evaluator.SyntaxError, 1, 18},
+		{"recur arity", "(loop (i 0) (recur 1 2))", evaluator.ArityError, 1, 13},
+		{"recur outside loop", "(recur 1)", evaluator.SyntaxError, 1, 2},
+		{"loop bindings", "(loop (i) i)", evaluator.SyntaxError, 1, 7},
+		{"loop unreached recur", "(loop (i 0) (if false (list (recur i)) i))", evaluator.SyntaxError, 1, 29},
+		{"recur in macro argument", "(macro wrap (x) (list '+ 1 x))\n(loop (i 0) (wrap (recur i)))", evaluator.SyntaxError, 2, 19},
+		{"dotimes count", "(dotimes (i \"a\") i)", evaluator.TypeError, 1, 13},
+		{"for-each seq", "(for-each (x 1) x)", evaluator.TypeError, 1, 14},
+		{"for-each pattern", "(for-each ((a b) (list 1)) a)", evaluator.TypeError, 1, 12},
+		{"range step", "(range 0 1 0)", evaluator.RuntimeError, 1, 12},
+		{"quoted operator", "(var x 1)\n('x 1)", evaluator.TypeError, 2, 2},
+		{"macro template", "(macro bad () (list 'nope))\n(bad)", evaluator.NameError, 1, 22},
+		{"macro built form", "(fn f (x) x)\n(macro m () (list 'f))\n(m)", evaluator.ArityError, 3, 1},
+		{"macro argument", "(macro neg (x) (list '- x))\n(neg \"a\")", evaluator.TypeError, 2, 6},
+		{"quasiquoted form", "(fn f (x) x)\n(macro m () `(f))\n(m)", evaluator.ArityError, 3, 1},
+		{"apply arity", "(fn f (x) x)\n(apply f (list))", evaluator.ArityError, 2, 1},
+		{"syntax rules template", "(syntax-rules sr () ((_ a) (nope a)))\n(sr 1)", evaluator.NameError, 1, 29},
+		{"syntax rules built form", "(fn f (x) x)\n(syntax-rules sr () ((_) (f)))\n(sr)", evaluator.ArityError, 3, 1},
+	}
+	for _, c := range cases {
+		e := evaluator.New()
+		_, err := e.EvalString(c.code)
+		var le *evaluator.Error
+		if !errors.As(err, &le) {
+			t.Fatalf("%s: expect *evaluator.Error, got %v", c.name, err)
+		}
+		if le.Kind != c.kind || le.Line != c.line || le.Column != c.column {
+			t.Errorf("%s: expect %v at %d:%d, got %v at %d:%d", c.name, c.kind, c.line, c.column, le.Kind, le.Line, le.Column)
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	cases := []struct {
+		name   string
+		code   string
+		expect []string
+	}{
+		{"nested", "(fn inner (x) (+ x \"a\"))\n(fn outer (x) (+ 1 (inner x)))\n(outer 1)",
+			[]string{"+ (1:15)", "inner (2:20)", "outer (3:1)"}},
+		{"tail calls", "(fn c (x) (+ x \"a\")) (fn b (x) (c x)) (fn a (x) (b x))\n(a 1)",
+			[]string{"+ (1:11)", "c (1:32)", "b (1:49)", "a (2:1)"}},
+		{"tail recursion", "(fn down (n) (if (= n 0) (+ n \"a\") (down (- n 1))))\n(down 5)",
+			[]string{"+ (1:26)", "down (1:36) x5", "down (2:1)"}},
+		{"apply", "(fn f (x) (+ x \"a\"))\n(apply f (list 1))",
+			[]string{"+ (1:11)", "f (2:1)"}},
+		{"macro", "(macro unless (c x) (list 'if c nil x))\n(fn f () (unless false (- \"a\")))\n(f)",
+			[]string{"- (2:24)", "macro unless (2:10)", "f (3:1)"}},
+	}
+	for _, c := range cases {
+		e := evaluator.New()
+		_, err := e.EvalString(c.code)
+		var le *evaluator.Error
+		if !errors.As(err, &le) {
+			t.Fatalf("%s: expect *evaluator.Error, got %v", c.name, err)
+		}
+		var frames []string
+		for _, f := range le.Stack {
+			frames = append(frames, f.String())
+		}
+		if !slices.Equal(frames, c.expect) {
+			t.Fatalf("%s: expect stack %q, got %q", c.name, c.expect, frames)
+		}
+	}
+}
+
+func TestMatchWarning(t *testing.T) {
+	e := evaluator.New()
+	var warnings []*evaluator.Error
+	e.OnWarning(func(w *evaluator.Error) {
+		warnings = append(warnings, w)
+	})
+	res, err := e.EvalString("(fn f (x) (match x (1 'one)))\n(list (f 1) (f 2))")
+	if err != nil || res.String() != "(one nil)" {
+		t.Fatalf("expect (one nil), got %v, %v", res, err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expect 1 warning, got %v", warnings)
+	}
+	w := warnings[0]
+	if w.Kind != evaluator.RuntimeError || w.Line != 1 || w.Column != 12 || w.Message != "no clause matches 2" {
+		t.Fatalf("expect a runtime error at 1:12, got %v", w)
+	}
+
+	e.OnWarning(nil)
+	if _, err := e.EvalString("(f 3)"); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expect warnings discarded, got %v", warnings)
+	}
+}
+
+func TestMatchWarningDefault(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	_, err = evaluator.New().EvalString("(match 2 (1 'one))")
+	os.Stderr = stderr
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := io.ReadAll(r); len(out) != 0 {
+		t.Fatalf("expect warnings discarded by default, got %q", out)
+	}
+}
+
+func TestErrorExpansion(t *testing.T) {
+	e := evaluator.New()
+	_, err := e.EvalStringNamed("m.gl", "(macro bad () `(nope 1))\n(fn f () (bad))\n(f)")
+	var le *evaluator.Error
+	if !errors.As(err, &le) {
+		t.Fatalf("expect *evaluator.Error, got %v", err)
+	}
+	if le.Expansion == nil || le.Expansion.Name != "bad" || le.Expansion.Line != 2 || le.Expansion.Column != 10 {
+		t.Fatalf("expect the error expanded from bad at 2:10, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "expanded from macro bad at m.gl:2:10") {
+		t.Fatalf("expect an expansion note, got %v", err)
+	}
+
+	_, err = e.EvalStringNamed("r.gl", "(syntax-rules sr () ((_ x) ((fn (y) (y)) x)))\n(fn g () (sr 1))\n(g)")
+	if !errors.As(err, &le) || le.Expansion == nil || le.Expansion.Name != "sr" || le.Line != 2 || le.Column != 10 {
+		t.Fatalf("expect the error expanded from sr at 2:10, got %v", err)
+	}
+
+	_, err = e.EvalString("(- \"a\")")
+	if !errors.As(err, &le) || le.Expansion != nil {
+		t.Fatalf("expect no expansion note, got %v", err)
+	}
+}
+
+func TestRuntimeFormsUnrecorded(t *testing.T) {
+	e := evaluator.New()
+	code := "(macro twice (x) `(+ ,x ,x))\n" +
+		"(syntax-rules swap () ((_ a b) ((fn (tmp) (list b tmp)) a)))\n" +
+		"(fn run (n) (loop (i 0) (if (< i n) (do (apply + (list (twice i) 1)) (swap i n) (recur (+ i 1))) i)))"
+	if _, err := e.EvalString(code); err != nil {
+		t.Fatal(err)
+	}
+	before := len(e.Positions)
+	if _, err := e.InvokeFunc("run", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Positions) != before {
+		t.Fatalf("expect no positions recorded at run time, got %d more", len(e.Positions)-before)
+	}
+}
+
+func TestErrorStackElided(t *testing.T) {
+	e := evaluator.New()
+	_, err := e.EvalString("(fn ping (n) (if (= n 0) (- \"a\") (pong n)))\n(fn pong (n) (ping (- n 1)))\n(ping 100)")
+	var le *evaluator.Error
+	if !errors.As(err, &le) {
+		t.Fatalf("expect *evaluator.Error, got %v", err)
+	}
+	last := le.Stack[len(le.Stack)-1]
+	if len(le.Stack) != 33 || last.Elided != 169 {
+		t.Fatalf("expect 32 tail frames after -, the oldest 169 calls elided, got %v", err)
+	}
+}
+
+func TestErrorStackFiles(t *testing.T) {
+	e := evaluator.New()
+	e.AddModuleFS(fstest.MapFS{
+		"rules.gl": {Data: []byte("(fn discount (x)\n  (- x \"a\"))")},
+	})
+	_, err := e.EvalStringNamed("main.gl", "(import \"rules\")\n(fn total (x) (+ 1 (rules/discount x)))\n(total 2)")
+	var le *evaluator.Error
+	if !errors.As(err, &le) {
+		t.Fatalf("expect *evaluator.Error, got %v", err)
+	}
+	if le.File != "rules.gl" || le.Line != 2 {
+		t.Fatalf("expect the error in rules.gl:2, got %v", err)
+	}
+	var files []string
+	for _, f := range le.Stack {
+		files = append(files, f.File)
+	}
+	if expect := []string{"rules.gl", "main.gl", "main.gl"}; !slices.Equal(files, expect) {
+		t.Fatalf("expect frames in %v, got %v", expect, err)
+	}
+}
+
+func TestHostError(t *testing.T) {
+	cause := errors.New("out of stock")
+	evaluator.RegisterBuiltin("reserve", func(params ...any) (any, error) {
+		return nil, cause
+	})
+	e := evaluator.New()
+	_, err := e.EvalString("(reserve 1)")
+	if !errors.Is(err, cause) {
+		t.Fatalf("expect error to wrap host error, got %v", err)
+	}
+}
+
+func TestInvokeUndefined(t *testing.T) {
+	e := evaluator.New()
+	_, err := e.InvokeFunc("nope")
+	var le *evaluator.Error
+	if !errors.As(err, &le) || le.Kind != evaluator.NameError {
+		t.Fatalf("expect name error, got %v", err)
+	}
+	if _, err := e.GetGlobal("nope"); !errors.As(err, &le) || le.Kind != evaluator.NameError {
+		t.Fatalf("expect name error, got %v", err)
+	}
+	if _, err := e.SetGlobal("nope", 1); !errors.As(err, &le) || le.Kind != evaluator.NameError {
+		t.Fatalf("expect name error, got %v", err)
+	}
+}
+
+func TestCatchHostError(t *testing.T) {
+	e := evaluator.New()
+	e.Register("reserve", func(params ...any) (any, error) {
+		return nil, errors.New("out of stock")
+	})
+	e.Register("charge", func(params ...any) (any, error) {
+		return nil, expr.NewError("card declined", expr.LVal(map[string]any{"code": 51}))
+	})
+	res, err := e.EvalString("(list (try (reserve 1) (catch e (list (error-kind e) (error-message e)))) (try (charge 1) (catch e (error-data e))))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != "((host error out of stock) {code 51})" {
+		t.Fatalf("expect the host errors caught, got %v", res)
+	}
+
+	_, err = e.EvalString("(charge 1)")
+	var le *evaluator.Error
+	if !errors.As(err, &le) || le.Kind != evaluator.ThrownError || le.Data.String() != "{code 51}" {
+		t.Fatalf("expect a thrown error with data, got %v", err)
+	}
+}
+
+func TestErrorRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "order.gl")
+	if err := os.WriteFile(path, []byte("(var total 1)\n(+ total\n   (- \"a\"))"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := evaluator.New()
+	_, err := e.EvalFile(path)
+	var le *evaluator.Error
+	if !errors.As(err, &le) {
+		t.Fatalf("expect *evaluator.Error, got %v", err)
+	}
+	expect := parser.Position{File: path, Line: 3, Column: 7, EndLine: 3, EndColumn: 10, Offset: 29, End: 32}
+	if le.Position != expect {
+		t.Fatalf("expect %#v, got %#v", expect, le.Position)
+	}
+	if !strings.HasPrefix(err.Error(), path+":3:7: type error") {
+		t.Fatalf("expect the message to start with the file, got %v", err)
+	}
+
+	_, err = e.EvalStringNamed("cart.gl", "(+ 1")
+	if !errors.As(err, &le) || le.Kind != evaluator.SyntaxError || le.File != "cart.gl" {
+		t.Fatalf("expect a syntax error in cart.gl, got %v", err)
+	}
+}
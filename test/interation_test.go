@@ -33,6 +33,13 @@ var TSS []testSuite = []testSuite{
 			{">=", "(>= 1 2)", "false"},
 			{"<=", "(<= 1 2)", "true"},
 			{"<=", "(<= 2 1)", "false"},
+			{"< chain", "(< 1 2 3)", "true"},
+			{"< unordered", "(< 1 3 2)", "false"},
+			{"<= chain", "(<= 1 1 2)", "true"},
+			{"<= unordered", "(<= 1 3 2)", "false"},
+			{"> unordered", "(> 3 1 2)", "false"},
+			{">= unordered", "(>= 3 1 2)", "false"},
+			{"< strings", "(< \"a\" \"c\" \"b\")", "false"},
 		},
 	},
 	{
@@ -41,15 +48,327 @@ var TSS []testSuite = []testSuite{
 			{"fib", "(fn fib (x) (if (< x 2) x (+ (fib (- x 1)) (fib (- x 2))))) (fib 10)", "55"},
 		},
 	},
+	{
+		"nil result",
+		[]testCase{
+			{"print nil?", "(nil? (print \"x\"))", "true"},
+			{"print =", "(var x (print 1)) (= x nil)", "true"},
+			{"print match", "(match (print 1) (nil 1) (_ 2))", "1"},
+			{"empty do", "(nil? (do))", "true"},
+		},
+	},
+	{
+		"tail call",
+		[]testCase{
+			{"self", "(fn count (n acc) (if (= n 0) acc (count (- n 1) (+ acc 1)))) (count 1000000 0)", "1000000"},
+			{"mutual", "(fn even (n) (if (= n 0) true (odd (- n 1)))) (fn odd (n) (if (= n 0) false (even (- n 1)))) (even 1000001)", "false"},
+			{"body", "(fn count (n) (var m (- n 1)) (if (= n 0) 'done (count m))) (count 1000000)", "done"},
+			{"apply", "(fn count (n) (if (= n 0) 'done (apply count (list (- n 1))))) (count 1000000)", "done"},
+		},
+	},
+	{
+		"quasiquote",
+		[]testCase{
+			{"symbol", "`a", "a"},
+			{"no unquote", "`(a b)", "(a b)"},
+			{"unquote", "(var x 2) `(1 ,x ,(+ x 1))", "(1 2 3)"},
+			{"splicing", "(var xs (list 2 3)) `(1 ,@xs 4)", "(1 2 3 4)"},
+			{"splicing empty", "`(1 ,@() 2)", "(1 2)"},
+			{"nested list", "(var x 1) `(a (b ,x) ,@(list x x))", "(a (b 1) 1 1)"},
+			{"nested quasiquote", "`(a `(b ,(c ,(+ 1 2))))", "(a (quasiquote (b (unquote (c 3)))))"},
+			{"nested splicing", "(var xs (list 1 2)) `(a `(b ,@(c ,@xs)))", "(a (quasiquote (b (unquote-splicing (c 1 2)))))"},
+			{"macro", "(macro swap (a b) `(,b ,a)) (swap 1 -)", "-1"},
+		},
+	},
+	{
+		"syntax-rules",
+		[]testCase{
+			{"gensym", "(type (gensym))", "symbol"},
+			{"gensym unique", "(= (gensym 'x) (gensym 'x))", "false"},
+			{"ellipsis", "(syntax-rules my-list () ((_ x ...) (list x ...))) (my-list 1 2 3)", "(1 2 3)"},
+			{"empty ellipsis", "(syntax-rules my-list () ((_ x ...) (list x ...))) (my-list)", "()"},
+			{"nested ellipsis", "(syntax-rules sums () ((_ (x y ...) ...) (list (+ x y ...) ...))) (sums (1 2 3) (4 5))", "(6 9)"},
+			{"tail after ellipsis", "(syntax-rules last-of () ((_ x ... y) y)) (last-of 1 2 3)", "3"},
+			{"vector pattern", "(syntax-rules with () ((_ [name value] body) ((fn (name) body) value))) (with [x 2] (* x 3))", "6"},
+			{"vector ellipsis", "(syntax-rules firsts () ((_ [a b ...] ...) (list a ...))) (firsts [1 2] [3] [4 5 6])", "(1 3 4)"},
+			{"vector pattern list form", "(syntax-rules vec? () ((_ [a]) 'vector) ((_ a) 'other)) (list (vec? [1]) (vec? (1)))", "(vector other)"},
+			{"literals", "(syntax-rules my-if (then else) ((_ c then t else e) (if c t e))) (my-if false then 1 else 2)", "2"},
+			{"rule order", "(syntax-rules arity () ((_) 0) ((_ a) 1) ((_ a b ...) 'many)) (list (arity) (arity 1) (arity 1 2))", "(0 1 many)"},
+			{"hygiene", "(syntax-rules swap () ((_ a b) ((fn (tmp) (set a b) (set b tmp)) a))) (var tmp 1) (var other 2) (swap tmp other) (list tmp other)", "(2 1)"},
+			{"hygiene var", "(syntax-rules with-ten () ((_ e) ((fn () (var x 10) (+ x e))))) (var x 5) (with-ten x)", "15"},
+		},
+	},
+	{
+		"map",
+		[]testCase{
+			{"literal", "{\"b\" 2 \"a\" (+ 0 1)}", "{a 1 b 2}"},
+			{"empty", "{}", "{}"},
+			{"type", "(type {})", "map"},
+			{"get", "(get {'a 1} 'a)", "1"},
+			{"get missing", "(get {'a 1} 'b)", "nil"},
+			{"get default", "(get {'a 1} 'b 0)", "0"},
+			{"number keys", "(keys {10 'x 9 'y 1 'z})", "(1 9 10)"},
+			{"assoc", "(var m {'a 1}) (list (assoc m 'b 2 'a 3) m)", "({a 3 b 2} {a 1})"},
+			{"dissoc", "(dissoc {'a 1 'b 2 'c 3} 'a 'c)", "{b 2}"},
+			{"keys", "(keys {'b 2 'a 1})", "(a b)"},
+			{"vals", "(vals {'b 2 'a 1})", "(1 2)"},
+			{"contains", "(list (contains? {'a nil} 'a) (contains? {'a nil} 'b))", "(true false)"},
+			{"merge", "(merge {'a 1 'b 2} nil {'b 3 'c 4})", "{a 1 b 3 c 4}"},
+			{"update", "(update {'qty 1} 'qty + 2)", "{qty 3}"},
+			{"update closure", "(update {} 'n (fn (x) (if x x 0)))", "{n 0}"},
+			{"equal", "(list (= {'a 1 'b 2} {'b 2 'a 1}) (= {'a 1} {'a 2}) (= {'a 1} {\"a\" 1}))", "(true false false)"},
+			{"len", "(len {'a 1 'b 2})", "2"},
+			{"nested", "(get (get {'order {'total 10}} 'order) 'total)", "10"},
+			{"string and symbol keys", "(list (get {(list \"a b\") 1} '(a b)) (get {\"a\" 1} 'a) (get {'(a) 1} (list \"a\")))", "(nil nil nil)"},
+			{"spaces in keys", "(list (get {(list \"a b\") 1} (list \"a\" \"b\")) (get {(list \"a b\") 1} (list \"a b\")))", "(nil 1)"},
+			{"number keys by value", "(list (get {1 'x} 1.0) (get {1.5M 'x} 1.5) (get {2.50M 'x} 2.5M) (get {1N 'x} 1) (get {0.1 'x} 0.1M))", "(x x x x x)"},
+			{"numbers in keys by type", "(list (get {(list 1) 'x} (list 1.0)) (= (list 1) (list 1.0)))", "(nil false)"},
+			{"keys of each type", "(len {1 'a \"1\" 'b (list 1) 'c [1] 'd (list \"1\") 'e})", "5"},
+			{"quoted literal", "(list (type '{a 1}) (get '{a 1} 'a) (get '{a b} 'a))", "(map 1 b)"},
+			{"quoted equal", "(var m {'a 1})\n(list (= m '{a 1}) (= m {'a 1 'b 2}))", "(true false)"},
+			{"quoted nested", "(get (get '{a {b (c d)}} 'a) 'b)", "(c d)"},
+			{"quasiquoted literal", "(var x 2)\n(var k 'b)\n`{a 1 ,k ,x}", "{a 1 b 2}"},
+			{"literal evaluates", "(var x 2)\n(var m {'a (+ x 1) (list x) x})\n(list (get m 'a) (get m (list 2)))", "(3 2)"},
+		},
+	},
+	{
+		"vector",
+		[]testCase{
+			{"literal", "[1 (+ 1 1) \"c\"]", "[1 2 c]"},
+			{"empty", "[]", "[]"},
+			{"type", "(type [])", "vector"},
+			{"constructor", "(vector 1 'a)", "[1 a]"},
+			{"index", "(list (. 0 [1 2 3]) (. -1 [1 2 3]))", "(1 3)"},
+			{"slice", "(: 1 -1 [1 2 3 4])", "[2 3]"},
+			{"len", "(len [1 2 3])", "3"},
+			{"equal", "(list (= [1 2] [1 2]) (= [1 2] (list 1 2)))", "(true false)"},
+			{"append", "(var a [1 2]) (var b (append a 3)) (var c (append a 4)) (list a b c)", "([1 2] [1 2 3] [1 2 4])"},
+			{"append list", "(var a (list 1 2)) (var b (append a 3)) (var c (append a 4)) (list a b c)", "((1 2) (1 2 3) (1 2 4))"},
+			{"append chain", "(var a (append [1] 2)) (var b (append a 3)) (var c (append a 4)) (list b c)", "([1 2 3] [1 2 4])"},
+			{"append slice", "(var a [1 2 3]) (var b (append (: 0 1 a) 9)) (list a b)", "([1 2 3] [1 9])"},
+			{"fn params", "(fn add [x y] (+ x y)) (add 1 2)", "3"},
+			{"fn varparam", "((fn [x & more] more) 1 2 3)", "(2 3)"},
+			{"macro params", "(macro my-when [c & body] `(if ,c (do ,@body) nil)) (my-when true 1 2)", "2"},
+			{"apply", "(apply + [1 2 3])", "6"},
+			{"quasiquote", "(var x 2) (var ys [3 4]) `[1 ,x ,@ys]", "[1 2 3 4]"},
+			{"syntax-rules", "(syntax-rules vfn () ((_ p b) (fn [p] b))) ((vfn x (+ x 1)) 1)", "2"},
+		},
+	},
+	{
+		"exception",
+		[]testCase{
+			{"no error", "(try (+ 1 2) (catch e 0))", "3"},
+			{"builtin error", "(try (. 10 [1 2]) (catch e (error-kind e)))", "index error"},
+			{"throw", "(try (throw \"boom\" {'code 1}) (catch e (list (error-message e) (error-data e) (error-kind e))))", "(boom {code 1} error)"},
+			{"throw value", "(try (throw (error \"x\" 1)) (catch e (error-data e)))", "1"},
+			{"rethrow", "(try (try (throw \"inner\") (catch e (throw e))) (catch e (error-message e)))", "inner"},
+			{"catch in function", "(fn safe-div (a b) (try (if (= b 0) (throw \"div by zero\") (/ a b)) (catch e nil))) (list (safe-div 4 2) (safe-div 1 0))", "(2 nil)"},
+			{"finally", "(var log (list)) (try (set log (append log 1)) (finally (set log (append log 2)))) log", "(1 2)"},
+			{"finally after catch", "(var log (list)) (list (try (throw \"x\") (catch e (set log (append log 'caught)) 'handled) (finally (set log (append log 'done)))) log)", "(handled (caught done))"},
+			{"finally rethrows", "(var done false) (try (try (throw \"x\") (finally (set done true))) (catch e done))", "true"},
+			{"error value", "(list (error? (error \"x\")) (error? 1) (type (error \"x\")))", "(true false error)"},
+			{"catch scope", "(var e 1) (try (throw \"x\") (catch e (error-message e))) e", "1"},
+		},
+	},
+	{
+		"number",
+		[]testCase{
+			{"literals", "(+ 1e3 0x10 1_000 .5 +1.)", "2017.5"},
+			{"exact decimal", "(= 0.15 (/ 15 100))", "true"},
+			{"int", "(+ 1 2)", "3"},
+			{"promotion", "(list (+ 1 2.0) (- 5 0.5) (* 2 1.5))", "(3.0 4.5 3.0)"},
+			{"division", "(list (/ 4 2) (/ 1 4) (/ 12 2 3) (/ 1 3) (/ 1 4.0))", "(2 0.25M 2 1/3M 0.25)"},
+			{"division overflow", "(try (/ -9223372036854775808 -1) (catch e (error-kind e)))", "arithmetic error"},
+			{"quot", "(list (quot 7 2) (quot -7 2) (quot 7.5 2))", "(3 -3 3.0)"},
+			{"mod", "(list (mod 7 3) (mod -7 3) (mod 7 -3) (mod 5.5 2))", "(1 2 -2 1.5)"},
+			{"exact int", "(+ 9007199254740993 0)", "9007199254740993"},
+			{"compare mixed", "(list (= 1 1.0) (< 1 1.5) (> 2.5 2))", "(true true true)"},
+			{"type", "(list (type 1) (type 1.0))", "(int float)"},
+			{"infinity", "(list +Inf -Inf Inf (* 2 Inf) (< -Inf -1e308))", "(+Inf -Inf +Inf +Inf true)"},
+			{"nan", "(list NaN (= NaN NaN) (type NaN))", "(NaN false float)"},
+		},
+	},
+	{
+		"decimal",
+		[]testCase{
+			{"literal", "(list 12.50M 1M -0.15M)", "(12.50M 1M -0.15M)"},
+			{"exact", "(list (+ 0.1M 0.2M) (* 0.8M 99.99M) (- 1M 0.01M))", "(0.3M 79.992M 0.99M)"},
+			{"scale", "(list (* 12.50M 2) (+ 1.5M 1.25M))", "(25.00M 2.75M)"},
+			{"division", "(list (/ 10M 4) (/ 1M 3) (* (/ 1M 3) 3))", "(2.5M 1/3M 1M)"},
+			{"fraction literal", "(list 1/3M -2/4M (= (/ 1M 3) 1/3M) (decimal \"1/3\"))", "(1/3M -0.5M true 1/3M)"},
+			{"quot and mod", "(list (quot 7M 2) (mod -7M 3) (mod 7.5M 2))", "(3M 2M 1.5M)"},
+			{"promotion", "(list (+ 1 0.5M) (+ 1N 0.5M) (+ 0.5M 0.5))", "(1.5M 1.5M 1.0)"},
+			{"compare", "(list (= 1.5M 1.50M) (= 1 1.0M) (< 0.1M 0.2 1 2N) (> 1.01M 1))", "(true true true true)"},
+			{"map key", "(get {1.5M 'a} 1.50M)", "a"},
+			{"float compare", "(list (= 0.1 1/10M) (= 0.3333333333333333 1/3M) (< 0.3333333333333333 1/3M) (= 9007199254740993 9007199254740992.0))", "(true false true false)"},
+			{"float map key", "(list (get {0.1 'a} 1/10M) (get {0.3333333333333333 'a} 1/3M))", "(a nil)"},
+			{"type", "(list (type 1M) (type 1N))", "(decimal bigint)"},
+			{"convert", "(list (decimal 0.1) (decimal \"12.50\") (decimal 3) (decimal 2N))", "(0.1M 12.50M 3M 2M)"},
+		},
+	},
+	{
+		"bigint",
+		[]testCase{
+			{"literal", "(list 9223372036854775808 12N)", "(9223372036854775808N 12N)"},
+			{"arithmetic", "(* 99999999999999999999 99999999999999999999)", "9999999999999999999800000000000000000001N"},
+			{"int promotion", "(+ 9223372036854775807 1N)", "9223372036854775808N"},
+			{"division", "(list (quot 7N 2) (mod -7N 3) (/ 1N 4) (/ 8N 4))", "(3N 2N 0.25M 2N)"},
+			{"exact division", "(list (/ 9007199254740993N 1) (/ 9007199254740993 3))", "(9007199254740993N 3002399751580331)"},
+		},
+	},
+	{
+		"destructuring",
+		[]testCase{
+			{"fn list", "(fn f ((a b) c) (list a b c)) (f (list 1 2) 3)", "(1 2 3)"},
+			{"fn vector", "(fn f ([a b]) (+ a b)) (f [1 2])", "3"},
+			{"nested", "(fn f ([a [b [c]]]) (list a b c)) (f (list 1 (list 2 [3])))", "(1 2 3)"},
+			{"rest", "(fn f ([a & more]) more) (list (f (list 1 2 3)) (f [1 2 3]) (f [1]))", "((2 3) [2 3] [])"},
+			{"variadic pattern", "(fn f (a & [b c]) (list a b c)) (f 1 2 3)", "(1 2 3)"},
+			{"ignore", "(fn f ([_ b _]) b) (f (list 1 2 3))", "2"},
+			{"map", "(fn f ({'sku s \"qty\" q}) (list s q)) (f {'sku \"A\" \"qty\" 2 'price 1.5})", "(A 2)"},
+			{"map nested", "(fn f ({'items [first & _]}) first) (f {'items [1 2]})", "1"},
+			{"var", "(var [a (b c) & d] [1 (list 2 3) 4 5]) (list a b c d)", "(1 2 3 [4 5])"},
+			{"macro", "(macro swap ((a b)) (list 'list b a)) (swap (1 2))", "(2 1)"},
+		},
+	},
+	{
+		"match",
+		[]testCase{
+			{"number literal", "(match 2 (1 'one) (2 'two))", "two"},
+			{"numbers by value", "(match 2.0 (2 'two))", "two"},
+			{"string literal", "(match \"b\" (\"a\" 1) (\"b\" 2))", "2"},
+			{"bool and nil literals", "(list (match false (true 1) (false 2)) (match nil (nil 'none)))", "(2 none)"},
+			{"quoted symbol", "(match 'stop ('go 1) ('stop 2))", "2"},
+			{"quoted list", "(match (list 1 'a) ('(1 a) 'yes))", "yes"},
+			{"symbol binds", "(match 5 (x (* x 2)))", "10"},
+			{"wildcard", "(match 5 (_ 'any))", "any"},
+			{"list shape", "(match (list 1 2) ((a) 'one) ((a b) (+ a b)))", "3"},
+			{"vector shape", "(match [1 [2 3]] ([a [b c]] (list a b c)))", "(1 2 3)"},
+			{"empty", "(match () ((a & _) 'some) (() 'empty))", "empty"},
+			{"rest", "(match [1 2 3] ([first & more] more))", "[2 3]"},
+			{"literal in list", "(match (list 'add 1 2) (('sub a b) (- a b)) (('add a b) (+ a b)))", "3"},
+			{"map keys", "(match {'type 'order 'total 10} ({'type 'refund} 'refund) ({'type 'order 'total t} t))", "10"},
+			{"map missing key", "(match {'a 1} ({'b b} b) ({'a a} a))", "1"},
+			{"type predicate", "(fn kind (x) (match x ((? int?) 'int) ((? string? s) s) (_ 'other))) (list (kind 1) (kind \"a\") (kind 1.5))", "(int a other)"},
+			{"closure predicate", "(match 7 ((? (fn (n) (> n 5)) n) n))", "7"},
+			{"guard", "(fn sign (n) (match n (x :when (< x 0) 'neg) (0 'zero) (_ 'pos))) (list (sign -1) (sign 0) (sign 3))", "(neg zero pos)"},
+			{"guard sees bindings", "(match [1 2] ([a b] :when (> a b) 'desc) ([a b] 'asc))", "asc"},
+			{"body", "(match 1 (x (var y (+ x 1)) (* y 10)))", "20"},
+			{"empty body", "(match 1 (1))", "nil"},
+			{"hygiene", "(syntax-rules add-to () ((_ v e) (match v (x (+ x e))))) (var x 10) (add-to 1 x)", "11"},
+			{"bindings scoped", "(var x 'outer) (match 1 (x x)) x", "outer"},
+			{"tail position", "(fn upto (acc n) (if (= n 0) acc (upto (append acc n) (- n 1)))) (fn count (xs n) (match xs (() n) ((_ & r) (count r (+ n 1))))) (count (upto () 100000) 0)", "100000"},
+		},
+	},
+	{
+		"round",
+		[]testCase{
+			{"default half even", "(list (round 2.5M) (round 3.5M) (round -2.5M))", "(2M 4M -2M)"},
+			{"places", "(round (* 0.8M 99.99M) 2)", "79.99M"},
+			{"keeps places", "(round 12M 2)", "12.00M"},
+			{"half even", "(list (round 0.125M 2 'half-even) (round 0.135M 2 'half-even))", "(0.12M 0.14M)"},
+			{"half up", "(list (round 0.125M 2 'half-up) (round -0.125M 2 'half-up))", "(0.13M -0.13M)"},
+			{"half down", "(list (round 0.125M 2 'half-down) (round 0.126M 2 'half-down))", "(0.12M 0.13M)"},
+			{"up and down", "(list (round 1.21M 1 'up) (round 1.29M 1 'down) (round -1.21M 1 'up))", "(1.3M 1.2M -1.3M)"},
+			{"ceiling and floor", "(list (round -1.21M 1 'ceiling) (round -1.21M 1 'floor))", "(-1.2M -1.3M)"},
+			{"negative places", "(list (round 1250 -2) (round 1350 -2 'half-up))", "(1200 1400)"},
+			{"float", "(list (round 2.675 2 'half-up) (round 2.5))", "(2.68 2.0)"},
+			{"bigint", "(round 99999999999999999950 -2 'half-up)", "100000000000000000000N"},
+		},
+	},
+	{
+		"loop",
+		[]testCase{
+			{"recur", "(loop (i 0 acc 0) (if (< i 10) (recur (+ i 1) (+ acc i)) acc))", "45"},
+			{"no recur", "(loop [x 1] (+ x 1))", "2"},
+			{"bindings in order", "(loop (a 1 b (+ a 1)) (list a b))", "(1 2)"},
+			{"patterns", "(loop ((a b) (list 0 1) n 10) (if (= n 0) a (recur (list b (+ a b)) (- n 1))))", "55"},
+			{"do", "(var out ()) (loop (i 0) (if (< i 3) (do (set out (append out i)) (recur (+ i 1))) out))", "(0 1 2)"},
+			{"match", "(loop (xs (list 1 2 3) n 0) (match xs (() n) ((x & r) (recur r (+ n x)))))", "6"},
+			{"body", "(loop (i 0) (var j (* i 2)) (if (< i 3) (recur (+ i 1)) j))", "6"},
+			{"nested", "(loop (i 0 acc ()) (if (< i 2) (recur (+ i 1) (append acc (loop (j 0 s i) (if (< j 3) (recur (+ j 1) (+ s j)) s)))) acc))", "(3 4)"},
+			{"bindings scoped", "(var i 'outer) (loop (i 0) (if (< i 3) (recur (+ i 1)) i)) i", "outer"},
+			{"many steps", "(loop (i 0 n 0) (if (< i 100000) (recur (+ i 1) (+ n i)) n))", "4999950000"},
+			{"hygiene", "(syntax-rules sum-to () ((_ n) (loop (i 0 acc 0) (if (< i n) (recur (+ i 1) (+ acc i)) acc)))) (var i 3) (sum-to i)", "3"},
+			{"macro expanded once", "(var n 0) (macro m (x) (set n (+ n 1)) x) (loop (i 0) (if (< i 2) (recur (+ i 1)) (m i))) n", "1"},
+			{"closures keep bindings", "(loop (i 0 fs ()) (if (< i 3) (recur (+ i 1) (append fs (fn () i))) (list ((. 0 fs)) ((. 2 fs)))))", "(0 2)"},
+		},
+	},
+	{
+		"iteration",
+		[]testCase{
+			{"while", "(var i 0) (var s 0) (while (< i 5) (set s (+ s i)) (set i (+ i 1))) s", "10"},
+			{"while value", "(while false 1)", "nil"},
+			{"while body", "(var i 0) (while (< i 3) (var j i) (set i (+ i 1))) i", "3"},
+			{"dotimes", "(var s 0) (dotimes (i 5) (set s (+ s i))) s", "10"},
+			{"dotimes none", "(var s 0) (dotimes [i -1] (set s 1)) s", "0"},
+			{"for-each list", "(var s ()) (for-each (x (list 1 2 3)) (set s (append s (* x x)))) s", "(1 4 9)"},
+			{"for-each vector", "(var s 0) (for-each ([a b] [[1 2] [3 4]]) (set s (+ s (* a b)))) s", "14"},
+			{"for-each map", "(var ks ()) (for-each ((k v) {'b 2 'a 1}) (set ks (append ks (list k v)))) ks", "((a 1) (b 2))"},
+			{"for-each many", "(var n 0) (for-each (x (range 100000)) (set n (+ n x))) n", "4999950000"},
+			{"for-each scoped", "(var x 'outer) (for-each (x (list 1 2)) x) x", "outer"},
+			{"range", "(list (range 3) (range 1 4) (range 0 10 3) (range 5 0 -2) (range 3 1))", "((0 1 2) (1 2 3) (0 3 6 9) (5 3 1) ())"},
+			{"range extremes", "(len (range 9223372036854775800 9223372036854775807))", "7"},
+			{"hygiene", "(syntax-rules twice () ((_ e) (do (var n 0) (dotimes (x 2) (set n (+ n e))) n))) (var x 5) (twice x)", "10"},
+			{"dotimes closures", "(var fs ()) (dotimes (i 3) (set fs (append fs (fn () i)))) (list ((. 0 fs)) ((. 2 fs)))", "(0 2)"},
+			{"for-each closures", "(var fs ()) (for-each (x (list 'a 'b)) (set fs (append fs (fn () x)))) (list ((. 0 fs)) ((. 1 fs)))", "(a b)"},
+			{"while closures", "(var i 0) (var fs ()) (while (< i 2) (var j i) (set fs (append fs (fn () j))) (set i (+ i 1))) (list ((. 0 fs)) ((. 1 fs)))", "(0 1)"},
+			{"nested closures", "(var fs ()) (dotimes (i 2) (dotimes (j 2) (set fs (append fs (fn () (list i j)))))) (list ((. 0 fs)) ((. 3 fs)))", "((0 0) (1 1))"},
+		},
+	},
+	{
+		"string",
+		[]testCase{
+			{"escapes", `(list "say \"hi\"" "a\tb" "caf\u00e9")`, "(say \"hi\" a\tb café)"},
+			{"multi-line", "(= \"a\nb\" \"a\\nb\")", "true"},
+			{"raw", `#"a\n"b"#`, `a\n"b`},
+			{"raw multi-line", "#\"<p>\n  \"hi\"\n</p>\"#", "<p>\n  \"hi\"\n</p>"},
+		},
+	},
+}
+
+var PreludeTSS []testSuite = []testSuite{
+	{
+		"tail call",
+		[]testCase{
+			{"let binding", "(let (a 1 b 2) (+ a b))", "3"},
+			{"and", "(and 1 2)", "2"},
+			{"or", "(or nil 2)", "2"},
+			{"and variadic", "(list (and) (and 1 2 3) (and 1 nil 3))", "(true 3 nil)"},
+			{"or variadic", "(list (or) (or nil false 3) (or 1 (undefined)))", "(nil 3 1)"},
+			{"and once", "(var n 0) (fn inc () (set n (+ n 1)) n) (and (inc) 1) n", "1"},
+			{"let hygiene", "(syntax-rules swap () ((_ a b) (let (tmp a) (do (set a b) (set b tmp))))) (var tmp 1) (var other 2) (swap tmp other) (list tmp other)", "(2 1)"},
+			{"let", "(fn count (n) (if (= n 0) 'done (let (m (- n 1)) (count m)))) (count 100000)", "done"},
+			{"map", "(fn upto (acc n) (if (= n 0) acc (upto (append acc n) (- n 1)))) (len (map (fn (x) (* 2 x)) (upto () 100000)))", "100000"},
+			{"pair", "(fn upto (acc n) (if (= n 0) acc (upto (append acc n) (- n 1)))) (len (pair (upto () 100000)))", "50000"},
+			{"concat", "(fn upto (acc n) (if (= n 0) acc (upto (append acc n) (- n 1)))) (len (concat (upto () 100000) (upto () 100000)))", "200000"},
+		},
+	},
+	{
+		"loop",
+		[]testCase{
+			{"let", "(loop (i 0) (let (j (+ i 1)) (if (< j 5) (recur j) j)))", "5"},
+			{"and", "(loop (i 0) (and (< i 5) (recur (+ i 1))))", "false"},
+		},
+	},
+	{
+		"destructuring",
+		[]testCase{
+			{"let", "(let ((a b) (list 1 2) {'c c} {'c 3}) (+ a b c))", "6"},
+			{"let rest", "(let ([x & xs] [1 2 3]) xs)", "[2 3]"},
+			{"map fn", "(map (fn ((k v)) (* k v)) (list (list 1 2) (list 3 4)))", "(2 12)"},
+			{"hygiene", "(syntax-rules first-plus () ((_ xs e) (let ([x & _] xs) (+ x e)))) (var x 10) (first-plus [1 2] x)", "11"},
+		},
+	},
 }
 
 func TestSuites(t *testing.T) {
 	for _, ts := range TSS {
 		for _, tc := range ts.testcases {
 			e := evaluator.New()
-			expr, ok := e.EvalString(tc.code)
-			if !ok {
-				t.Fatalf("%s: %s failed, EvalString not ok", ts.name, tc.name)
+			expr, err := e.EvalString(tc.code)
+			if err != nil {
+				t.Fatalf("%s: %s failed, %v", ts.name, tc.name, err)
 			}
 			if expr.String() != tc.expect {
 				t.Fatalf("%s: %s failed, expect %s, got %s", ts.name, tc.name, tc.expect, expr.String())
@@ -57,3 +376,33 @@ func TestSuites(t *testing.T) {
 		}
 	}
 }
+
+func TestPreludeSuites(t *testing.T) {
+	for _, ts := range PreludeTSS {
+		for _, tc := range ts.testcases {
+			e := evaluator.WithPrelude()
+			expr, err := e.EvalString(tc.code)
+			if err != nil {
+				t.Fatalf("%s: %s failed, %v", ts.name, tc.name, err)
+			}
+			if expr.String() != tc.expect {
+				t.Fatalf("%s: %s failed, expect %s, got %s", ts.name, tc.name, tc.expect, expr.String())
+			}
+		}
+	}
+}
+
+func TestIterationAllocs(t *testing.T) {
+	e := evaluator.New()
+	if _, err := e.EvalString("(var xs (range 100000))"); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(1, func() {
+		if _, err := e.EvalString("(for-each (x xs) x)"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 1000 {
+		t.Fatalf("expect no allocation per step, got %v for 100000 steps", allocs)
+	}
+}
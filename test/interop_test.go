@@ -0,0 +1,601 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guiyuanju/golisp/evaluator"
+	"github.com/guiyuanju/golisp/expr"
+)
+
+func TestNumberRoundTrip(t *testing.T) {
+	cases := []struct {
+		in     any
+		expect any
+	}{
+		{3, int64(3)},
+		{int32(-3), int64(-3)},
+		{uint(7), int64(7)},
+		{int64(9007199254740993), int64(9007199254740993)},
+		{float32(0.5), 0.5},
+		{1.5, 1.5},
+	}
+	for _, c := range cases {
+		if got := expr.GVal(expr.LVal(c.in)); got != c.expect {
+			t.Errorf("%T %v: expect %T %v, got %T %v", c.in, c.in, c.expect, c.expect, got, got)
+		}
+	}
+
+	if got := expr.GVal(expr.LVal(uint64(1 << 63))); got.(*big.Int).String() != "9223372036854775808" {
+		t.Errorf("expect 9223372036854775808, got %v", got)
+	}
+
+	e := evaluator.New()
+	twice, err := e.EvalString("(fn (x) (* x 2))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var small func(x int32) (int32, error)
+	if err := e.BindFunc(twice, &small); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := small(21); err != nil || v != 42 {
+		t.Fatalf("expect 42, got %v, %v", v, err)
+	}
+	if _, err := small(1 << 30); err == nil {
+		t.Fatal("expect an overflow error for int32")
+	}
+	var exact func(x *big.Rat) (*big.Rat, error)
+	if err := e.BindFunc(twice, &exact); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := exact(big.NewRat(1, 3)); err != nil || v.Cmp(big.NewRat(2, 3)) != 0 {
+		t.Fatalf("expect 2/3, got %v, %v", v, err)
+	}
+	var whole func(x *big.Int) (int, error)
+	if err := e.BindFunc(twice, &whole); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := whole(big.NewInt(21)); err != nil || v != 42 {
+		t.Fatalf("expect 42, got %v, %v", v, err)
+	}
+	var unsigned func(x int) (uint, error)
+	if err := e.BindFunc(twice, &unsigned); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unsigned(-1); err == nil {
+		t.Fatal("expect an error for a negative uint")
+	}
+}
+
+func TestMapRoundTrip(t *testing.T) {
+	order := map[string]any{
+		"id":    12.0,
+		"tags":  []any{"vip", "eu"},
+		"total": map[string]any{"amount": 99.5, "currency": "EUR"},
+	}
+	if got := expr.GVal(expr.LVal(order)); !reflect.DeepEqual(got, order) {
+		t.Fatalf("expect %v, got %v", order, got)
+	}
+
+	e := evaluator.New()
+	if _, err := e.EvalString("(fn discount (order) (update order \"total\" (fn (t) (assoc t \"amount\" (* 0.5 (get t \"amount\"))))))"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.InvokeFunc("discount", order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]any{
+		"id":    12.0,
+		"tags":  []any{"vip", "eu"},
+		"total": map[string]any{"amount": 49.75, "currency": "EUR"},
+	}
+	if !reflect.DeepEqual(res, expect) {
+		t.Fatalf("expect %v, got %v", expect, res)
+	}
+
+	// keys other than names keep apart, keyed by KeyOf
+	mixed, err := e.EvalString("{1 'a \"1\" 'b}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]any{
+		expr.KeyOf(expr.NewInt(1)):      "a",
+		expr.KeyOf(expr.NewString("1")): "b",
+	}
+	if got := expr.GVal(mixed); !reflect.DeepEqual(got, keys) {
+		t.Fatalf("expect %v, got %v", keys, got)
+	}
+}
+
+type lineItem struct {
+	SKU   string
+	Qty   int
+	Price float64
+}
+
+func TestRegisterFunc(t *testing.T) {
+	errOutOfStock := errors.New("out of stock")
+	e := evaluator.New()
+	e.RegisterFunc("add", func(a, b int) int { return a + b })
+	e.RegisterFunc("scale", func(x float32, by uint8) float64 { return float64(x) * float64(by) })
+	e.RegisterFunc("join", strings.Join)
+	e.RegisterFunc("sum", func(xs ...int) int {
+		res := 0
+		for _, x := range xs {
+			res += x
+		}
+		return res
+	})
+	e.RegisterFunc("total", func(items []lineItem) float64 {
+		res := 0.0
+		for _, item := range items {
+			res += float64(item.Qty) * item.Price
+		}
+		return res
+	})
+	e.RegisterFunc("stock", func(m map[string]int, sku string) (int, bool) {
+		n, ok := m[sku]
+		return n, ok
+	})
+	e.RegisterFunc("item", func(sku string) *lineItem { return &lineItem{SKU: sku, Qty: 1} })
+	e.RegisterFunc("reserve", func(qty int) (int, error) {
+		if qty > 3 {
+			return 0, errOutOfStock
+		}
+		return qty, nil
+	})
+	e.RegisterFunc("noop", func() {})
+	e.RegisterFunc("deadline?", func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return ok
+	})
+	e.RegisterFunc("id", func(v any) any { return v })
+
+	cases := []testCase{
+		{"ints", "(add 1 2)", "3"},
+		{"floats", "(scale 1.5 2)", "3.0"},
+		{"strings", "(join (list \"a\" \"b\") \",\")", "a,b"},
+		{"variadic", "(list (sum) (sum 1 2 3))", "(0 6)"},
+		{"structs", "(total [{'sku \"A\" 'qty 2 'price 1.5} {\"Qty\" 1 \"Price\" 2}])", "5.0"},
+		{"maps", "(stock {\"A\" 3} \"A\")", "(3 true)"},
+		{"pointer result", "(get (item \"A\") \"SKU\")", "A"},
+		{"error result", "(reserve 2)", "2"},
+		{"no result", "(noop)", "nil"},
+		{"context", "(deadline?)", "false"},
+		{"any", "(id [1 \"a\"])", "(1 a)"},
+	}
+	for _, c := range cases {
+		res, err := e.EvalString(c.code)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if res.String() != c.expect {
+			t.Fatalf("%s: expect %s, got %s", c.name, c.expect, res)
+		}
+	}
+
+	res, err := e.EvalStringContext(context.Background(), evaluator.Limits{Timeout: time.Second}, "(deadline?)")
+	if err != nil || res.String() != "true" {
+		t.Fatalf("expect the run's context, got %v, %v", res, err)
+	}
+
+	errCases := []struct {
+		name string
+		code string
+		kind evaluator.ErrorKind
+	}{
+		{"too few", "(add 1)", evaluator.ArityError},
+		{"too many", "(add 1 2 3)", evaluator.ArityError},
+		{"not int", "(add 1 \"2\")", evaluator.TypeError},
+		{"fraction", "(add 1 2.5)", evaluator.TypeError},
+		{"overflow", "(scale 1 256)", evaluator.TypeError},
+		{"negative uint", "(scale 1 -1)", evaluator.TypeError},
+		{"variadic element", "(sum 1 'a)", evaluator.TypeError},
+		{"unknown field", "(total [{'color 1}])", evaluator.TypeError},
+		{"field type", "(total [{'qty \"2\"}])", evaluator.TypeError},
+		{"returned error", "(reserve 5)", evaluator.HostError},
+	}
+	for _, c := range errCases {
+		_, err := e.EvalString(c.code)
+		var le *evaluator.Error
+		if !errors.As(err, &le) || le.Kind != c.kind {
+			t.Fatalf("%s: expect %v, got %v", c.name, c.kind, err)
+		}
+	}
+	if _, err := e.EvalString("(reserve 5)"); !errors.Is(err, errOutOfStock) {
+		t.Fatalf("expect the returned error to be wrapped, got %v", err)
+	}
+}
+
+type order struct {
+	ID     int
+	Total  float64
+	coupon string
+}
+
+func (o *order) ApplyCoupon(code string) (float64, error) {
+	if code != "X" {
+		return 0, errors.New("invalid coupon")
+	}
+	o.coupon = code
+	o.Total *= 0.9
+	return o.Total, nil
+}
+
+func (o *order) Cancel() {
+	o.Total = 0
+}
+
+func TestGoObjectEqual(t *testing.T) {
+	type holder struct{ V any }
+	xs := []int{1, 2}
+	m := map[string]int{"a": 1}
+	cases := []struct {
+		name  string
+		a, b  any
+		equal bool
+	}{
+		{"same pointer", &order{ID: 1}, nil, true},
+		{"other pointer", &order{ID: 1}, &order{ID: 1}, false},
+		{"comparable", holder{1}, holder{1}, true},
+		{"uncomparable field", holder{[]int{1}}, holder{[]int{1}}, false},
+		{"same slice", xs, xs, true},
+		{"other slice", xs, []int{1, 2}, false},
+		{"subslice", xs, xs[:1], false},
+		{"same map", m, m, true},
+		{"other map", m, map[string]int{"a": 1}, false},
+		{"func", func() {}, func() {}, false},
+	}
+	for _, c := range cases {
+		if c.b == nil {
+			c.b = c.a
+		}
+		if got := expr.NewGoObject(c.a).Equal(expr.NewGoObject(c.b)); got != c.equal {
+			t.Errorf("%s: expect %v, got %v", c.name, c.equal, got)
+		}
+	}
+	f := expr.NewGoObject(func() {})
+	if !f.Equal(f) {
+		t.Error("expect an object equal to itself")
+	}
+}
+
+func TestGoObject(t *testing.T) {
+	o := &order{ID: 1, Total: 100}
+	obj := expr.LVal(o)
+	if obj.String() != "<object *test.order>" {
+		t.Fatalf("expect the type printed, got %s", obj)
+	}
+	if expr.GVal(obj) != o {
+		t.Fatal("expect GVal to return the object unchanged")
+	}
+
+	e := evaluator.New()
+	e.Expose(&order{}, "Total", "ApplyCoupon")
+	e.RegisterFunc("find-order", func(id int) *order { return &order{ID: id, Total: 10} })
+	if _, err := e.EvalString("(fn checkout (o) (.. o 'ApplyCoupon \"X\") o)"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.InvokeFunc("checkout", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != o || o.coupon != "X" || o.Total != 90 {
+		t.Fatalf("expect the same order with the coupon applied, got %v", res)
+	}
+
+	cases := []testCase{
+		{"field", "(.. (find-order 2) 'Total)", "10.0"},
+		{"method", "(.. (find-order 2) 'ApplyCoupon \"X\")", "9.0"},
+		{"type", "(type (find-order 2))", "object"},
+		{"print", "(find-order 2)", "<object *test.order>"},
+	}
+	for _, c := range cases {
+		res, err := e.EvalString(c.code)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if res.String() != c.expect {
+			t.Fatalf("%s: expect %s, got %s", c.name, c.expect, res)
+		}
+	}
+
+	errCases := []struct {
+		name string
+		code string
+		kind evaluator.ErrorKind
+	}{
+		{"not allowed field", "(.. (find-order 2) 'ID)", evaluator.NameError},
+		{"not allowed method", "(.. (find-order 2) 'Cancel)", evaluator.NameError},
+		{"unexported", "(.. (find-order 2) 'coupon)", evaluator.NameError},
+		{"method arity", "(.. (find-order 2) 'ApplyCoupon)", evaluator.ArityError},
+		{"method error", "(.. (find-order 2) 'ApplyCoupon \"Y\")", evaluator.HostError},
+		{"not object", "(.. 1 'Total)", evaluator.TypeError},
+	}
+	for _, c := range errCases {
+		_, err := e.EvalString(c.code)
+		var le *evaluator.Error
+		if !errors.As(err, &le) || le.Kind != c.kind {
+			t.Fatalf("%s: expect %v, got %v", c.name, c.kind, err)
+		}
+	}
+
+	// types not exposed stay opaque
+	other := evaluator.New()
+	other.Register("find-order", func(...any) (any, error) { return &order{ID: 1}, nil })
+	_, err = other.EvalString("(.. (find-order 1) 'Total)")
+	var le *evaluator.Error
+	if !errors.As(err, &le) || le.Kind != evaluator.TypeError || !strings.Contains(le.Message, "not exposed") {
+		t.Fatalf("expect a type error, got %v", err)
+	}
+	if _, err := other.EvalString("(fn id (x) x)"); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := other.InvokeFunc("id", o); err != nil || res != o {
+		t.Fatalf("expect the order passed through, got %v, %v", res, err)
+	}
+}
+
+func TestCallback(t *testing.T) {
+	e := evaluator.New()
+	e.RegisterFunc("sort-by", func(xs []int, less func(a, b int) bool) []int {
+		sort.Slice(xs, func(i, j int) bool { return less(xs[i], xs[j]) })
+		return xs
+	})
+	e.Register("call-twice", func(args ...any) (any, error) {
+		f := args[0].(func(...any) (any, error))
+		x, err := f(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return f(x)
+	})
+	res, err := e.EvalString("(list (sort-by [3 1 2] (fn (a b) (> a b))) (call-twice (fn (x) (* x 2)) 3))")
+	if err != nil || res.String() != "((3 2 1) 12)" {
+		t.Fatalf("expect ((3 2 1) 12), got %v, %v", res, err)
+	}
+
+	if _, err := e.EvalString("(fn adder (n) (fn (x) (+ x n))) (var inc (adder 1))"); err != nil {
+		t.Fatal(err)
+	}
+	add, err := e.InvokeFunc("adder", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := add.(func(...any) (any, error))(5); err != nil || v != int64(15) {
+		t.Fatalf("expect 15, got %v, %v", v, err)
+	}
+	inc, err := e.GetGlobal("inc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := inc.(func(...any) (any, error))(1); err != nil || v != int64(2) {
+		t.Fatalf("expect 2, got %v, %v", v, err)
+	}
+	if _, err := inc.(func(...any) (any, error))(); err == nil {
+		t.Fatal("expect the script error returned")
+	}
+
+	plus, err := e.EvalString("+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := e.GoFunc(plus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := sum(1, 2); err != nil || v != int64(3) {
+		t.Fatalf("expect 3, got %v, %v", v, err)
+	}
+	if _, err := e.GoFunc(expr.NewInt(1)); err == nil {
+		t.Fatal("expect an error for a non function")
+	}
+
+	divmod, err := e.EvalString("(fn (a b) (list (/ a b) (- a (* b (/ a b)))))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var split func(a, b float64) (float64, float64, error)
+	if err := e.BindFunc(divmod, &split); err != nil {
+		t.Fatal(err)
+	}
+	if q, r, err := split(6, 3); err != nil || q != 2 || r != 0 {
+		t.Fatalf("expect 2 0, got %v %v %v", q, r, err)
+	}
+	fail, err := e.EvalString("(fn (x) (undefined x))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var check func(x int) error
+	if err := e.BindFunc(fail, &check); err != nil {
+		t.Fatal(err)
+	}
+	var le *evaluator.Error
+	if err := check(1); !errors.As(err, &le) || le.Kind != evaluator.NameError {
+		t.Fatalf("expect a name error, got %v", err)
+	}
+	var mustCheck func(x int)
+	if err := e.BindFunc(fail, &mustCheck); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expect a panic without an error result")
+			}
+		}()
+		mustCheck(1)
+	}()
+	if err := e.BindFunc(fail, mustCheck); err == nil {
+		t.Fatal("expect an error for a non pointer")
+	}
+}
+
+type customer struct {
+	Name string
+	Tier string `golisp:"tier,omitempty"`
+}
+
+type quote struct {
+	ID           int                `golisp:"id"`
+	DiscountRate float64            `golisp:"discount-rate"`
+	Customer     *customer          `golisp:"customer"`
+	Items        []lineItem         `golisp:"items"`
+	Totals       map[string]float64 `golisp:"totals"`
+	ValidUntil   time.Time          `golisp:"valid-until"`
+	Note         string             `golisp:"-"`
+	Tags         []string
+}
+
+func TestDecodeEncode(t *testing.T) {
+	e := evaluator.New()
+	res, err := e.EvalString(`
+{'id 7
+ 'discount-rate 0.25
+ 'customer {'name "Ada"}
+ 'items [{'sku "A1" 'qty 2 'price 9.5}]
+ 'totals {"EUR" 19}
+ 'valid-until "2025-01-02T15:04:05Z"
+ 'tags (list "vip")}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q quote
+	if err := evaluator.Decode(res, &q); err != nil {
+		t.Fatal(err)
+	}
+	expect := quote{
+		ID:           7,
+		DiscountRate: 0.25,
+		Customer:     &customer{Name: "Ada"},
+		Items:        []lineItem{{SKU: "A1", Qty: 2, Price: 9.5}},
+		Totals:       map[string]float64{"EUR": 19},
+		ValidUntil:   time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Tags:         []string{"vip"},
+	}
+	if !reflect.DeepEqual(q, expect) {
+		t.Fatalf("expect %+v, got %+v", expect, q)
+	}
+
+	// Go values returned by InvokeFunc decode the same
+	if _, err := e.EvalString("(fn make-quote () {\"id\" 8 \"items\" []})"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := e.InvokeFunc("make-quote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q2 quote
+	if err := evaluator.Decode(v, &q2); err != nil || q2.ID != 8 {
+		t.Fatalf("expect id 8, got %+v, %v", q2, err)
+	}
+
+	encoded, err := evaluator.Encode(expect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.EvalString("(fn total-qty (q) (get (. 0 (get q \"items\")) \"Qty\"))"); err != nil {
+		t.Fatal(err)
+	}
+	if qty, err := e.InvokeFunc("total-qty", encoded); err != nil || qty != int64(2) {
+		t.Fatalf("expect 2, got %v, %v", qty, err)
+	}
+	var back quote
+	if err := evaluator.Decode(encoded, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, expect) {
+		t.Fatalf("expect the round trip to keep %+v, got %+v", expect, back)
+	}
+	if m := encoded.(expr.Map); m.Len() != 7 {
+		t.Fatalf("expect Note skipped, got %v", m)
+	}
+	if s := encoded.String(); strings.Contains(s, "tier") {
+		t.Fatalf("expect empty tier omitted, got %s", s)
+	}
+
+	// strings encode as strings, not as the forms they read as
+	strs, err := evaluator.Encode([]string{"'abc", "1", "nil"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := expr.NewList(expr.NewString("'abc"), expr.NewString("1"), expr.NewString("nil")); !strs.Equal(expect) {
+		t.Fatalf("expect %v, got %v", expect, strs)
+	}
+
+	errCases := []struct {
+		code string
+		path string
+	}{
+		{"{'id \"7\"}", "id"},
+		{"{'items [{'sku \"A\"} {'qty 1.5}]}", "items[1].qty"},
+		{"{'customer {'name 1}}", "customer.name"},
+		{"{'totals {\"EUR\" 'x}}", "totals[EUR]"},
+		{"{'valid-until \"tomorrow\"}", "valid-until"},
+		{"{'colour \"red\"}", "colour"},
+		{"{\"\" \"a note\"}", ""},
+	}
+	for _, c := range errCases {
+		res, err := e.EvalString(c.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var q quote
+		err = evaluator.Decode(res, &q)
+		var ce *evaluator.ConvertError
+		if !errors.As(err, &ce) || ce.Path != c.path {
+			t.Fatalf("%s: expect an error at %s, got %v", c.code, c.path, err)
+		}
+	}
+	if err := evaluator.Decode(1, q); err == nil {
+		t.Fatal("expect an error for a non pointer target")
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+}
+
+func TestEncodeCycle(t *testing.T) {
+	loop := &node{Name: "a", Next: &node{Name: "b"}}
+	loop.Next.Next = loop
+	xs := []any{1, nil}
+	xs[1] = xs
+	m := map[string]any{}
+	m["self"] = m
+	cases := []struct {
+		name string
+		v    any
+		path string
+	}{
+		{"pointer", loop, "Next.Next"},
+		{"slice", xs, "[1]"},
+		{"map", m, "[self]"},
+	}
+	for _, c := range cases {
+		_, err := evaluator.Encode(c.v)
+		var ce *evaluator.ConvertError
+		if !errors.As(err, &ce) || ce.Path != c.path {
+			t.Fatalf("%s: expect a cycle at %s, got %v", c.name, c.path, err)
+		}
+	}
+
+	// a value shared without a cycle converts each time reached
+	shared := &node{Name: "s"}
+	res, err := evaluator.Encode([]*node{shared, shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != "({Name s Next nil} {Name s Next nil})" {
+		t.Fatalf("expect the shared node twice, got %s", res)
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/guiyuanju/golisp/evaluator"
+)
+
+func TestLimits(t *testing.T) {
+	type limitCase struct {
+		name   string
+		code   string
+		limits evaluator.Limits
+		expect error
+	}
+	cases := []limitCase{
+		{"steps", "(fn f (x) (f x)) (f 1)", evaluator.Limits{MaxSteps: 10000}, evaluator.ErrStepLimit},
+		{"timeout", "(fn f (x) (f x)) (f 1)", evaluator.Limits{Timeout: 20 * time.Millisecond}, context.DeadlineExceeded},
+		{"depth", "(fn f (x) (+ 1 (f x))) (f 1)", evaluator.Limits{MaxDepth: 1000}, evaluator.ErrDepthLimit},
+		{"list", "(list 1 2 3 4)", evaluator.Limits{MaxListSize: 3}, evaluator.ErrListLimit},
+		{"append", "(fn grow (xs) (grow (append xs 1))) (grow ())", evaluator.Limits{MaxListSize: 100}, evaluator.ErrListLimit},
+		{"while", "(while true 1)", evaluator.Limits{MaxSteps: 10000}, evaluator.ErrStepLimit},
+		{"range", "(range 10)", evaluator.Limits{MaxListSize: 3}, evaluator.ErrListLimit},
+		{"hash-map", "(hash-map 1 1 2 2 3 3 4 4)", evaluator.Limits{MaxListSize: 3}, evaluator.ErrListLimit},
+		{"assoc", "(fn grow (m n) (grow (assoc m n n) (+ n 1))) (grow {} 0)", evaluator.Limits{MaxListSize: 100}, evaluator.ErrListLimit},
+		{"update", "(fn grow (m n) (grow (update m n (fn (x) n)) (+ n 1))) (grow {} 0)", evaluator.Limits{MaxListSize: 100}, evaluator.ErrListLimit},
+		{"merge", "(fn grow (m n) (grow (merge m {n n}) (+ n 1))) (grow {} 0)", evaluator.Limits{MaxListSize: 100}, evaluator.ErrListLimit},
+		{"uncatchable", "(fn f (x) (f x)) (try (f 1) (catch e 'caught))", evaluator.Limits{MaxSteps: 10000}, evaluator.ErrStepLimit},
+	}
+	for _, c := range cases {
+		e := evaluator.New()
+		_, err := e.EvalStringContext(context.Background(), c.limits, c.code)
+		var le *evaluator.Error
+		if !errors.As(err, &le) || le.Kind != evaluator.LimitError || !errors.Is(err, c.expect) {
+			t.Fatalf("%s: expect limit error %v, got %v", c.name, c.expect, err)
+		}
+	}
+}
+
+func TestLimitsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	e := evaluator.New()
+	_, err := e.EvalStringContext(ctx, evaluator.Limits{}, "(fn f (x) (f x)) (f 1)")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+}
+
+func TestLimitsWithinBudget(t *testing.T) {
+	e := evaluator.New()
+	limits := evaluator.Limits{MaxSteps: 100000, MaxDepth: 100, MaxListSize: 10}
+	if _, err := e.EvalStringContext(context.Background(), limits, "(fn count (n) (if (= n 0) 'done (count (- n 1))))"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.InvokeFuncContext(context.Background(), limits, "count", 1000)
+	if err != nil || res != "done" {
+		t.Fatalf("expect done, got %v, %v", res, err)
+	}
+	// limits apply per run
+	_, err = e.InvokeFuncContext(context.Background(), evaluator.Limits{MaxSteps: 100}, "count", 1000)
+	if !errors.Is(err, evaluator.ErrStepLimit) {
+		t.Fatalf("expect step limit, got %v", err)
+	}
+	// and not to unlimited runs
+	if _, err := e.InvokeFunc("count", 1000); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitsDepthStack(t *testing.T) {
+	e := evaluator.New()
+	_, err := e.EvalStringContext(context.Background(), evaluator.Limits{MaxDepth: 2000}, "(fn f (x) (+ 1 (f x)))\n(f 1)")
+	var le *evaluator.Error
+	if !errors.As(err, &le) || !errors.Is(err, evaluator.ErrDepthLimit) {
+		t.Fatalf("expect depth limit, got %v", err)
+	}
+	if len(le.Stack) != 2 || le.Stack[0].Name != "f" || le.Stack[0].Calls < 600 {
+		t.Fatalf("expect the recursive calls to share a frame, got %v", err)
+	}
+
+	_, err = e.EvalStringContext(context.Background(), evaluator.Limits{MaxDepth: 2000}, "(fn a (x) (+ 1 (b x)))\n(fn b (x) (+ 1 (a x)))\n(a 1)")
+	if !errors.As(err, &le) || len(le.Stack) != 64 || le.Stack[63].Elided == 0 {
+		t.Fatalf("expect the stack cut at 64 frames, got %d frames", len(le.Stack))
+	}
+}
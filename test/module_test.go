@@ -0,0 +1,116 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/guiyuanju/golisp/evaluator"
+)
+
+var modules = fstest.MapFS{
+	"pricing.gl": {Data: []byte(`
+(module pricing (export apply unless))
+(import "lib/util")
+(var rate 0.5)
+(fn secret (x) (* x rate))
+(fn apply (x) (util/identity (secret x)))
+(macro unless (c a b) (list 'if c b a))
+`)},
+	"lib/util.gl": {Data: []byte(`
+(import "./counter")
+(counter/touch)
+(fn identity (x) x)
+`)},
+	"lib/counter.gl": {Data: []byte(`
+(module counter (export touch))
+(fn touch () (loaded))
+`)},
+	"cycle/a.gl":    {Data: []byte(`(import "cycle/b")`)},
+	"cycle/b.gl":    {Data: []byte(`(import "cycle/a")`)},
+	"bad-export.gl": {Data: []byte(`(module bad (export missing))`)},
+	"peek.gl":       {Data: []byte(`(var seen hidden)`)},
+	"prelude.gl":    {Data: []byte(`(fn doubles (xs) (map (fn (x) (* 2 x)) xs))`)},
+}
+
+func TestModules(t *testing.T) {
+	loads := 0
+	e := evaluator.New()
+	e.AddModuleFS(modules)
+	e.Register("loaded", func(...any) (any, error) {
+		loads++
+		return nil, nil
+	})
+
+	cases := []testCase{
+		{"alias", "(import \"pricing\" :as p) (p/apply 10)", "5.0"},
+		{"name", "(import \"pricing\") (pricing/apply 4)", "2.0"},
+		{"macro", "(p/unless false 1 2)", "1"},
+		{"nested import", "(import \"lib/util\" :as u) (u/identity 3)", "3"},
+		{"value", "p", "<module pricing>"},
+		{"builtins still global", "(/ 4 2)", "2"},
+	}
+	for _, c := range cases {
+		res, err := e.EvalString(c.code)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if res.String() != c.expect {
+			t.Fatalf("%s: expect %s, got %s", c.name, c.expect, res)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect modules loaded once, got %d loads", loads)
+	}
+	if res, err := e.InvokeFunc("p/apply", 8); err != nil || res != 4.0 {
+		t.Fatalf("expect 4, got %v, %v", res, err)
+	}
+
+	errCases := []struct {
+		name    string
+		code    string
+		kind    evaluator.ErrorKind
+		message string
+	}{
+		{"not exported", "(p/secret 1)", evaluator.NameError, "not exported: p/secret"},
+		{"own layer", "rate", evaluator.NameError, "undefined: rate"},
+		{"not found", "(import \"missing\")", evaluator.NameError, "cannot import missing.gl"},
+		{"circular", "(import \"cycle/a\")", evaluator.RuntimeError, "circular import: cycle/a.gl -> cycle/b.gl -> cycle/a.gl"},
+		{"undefined export", "(import \"bad-export\")", evaluator.NameError, "exports undefined missing"},
+		{"outside", "(module top)", evaluator.RuntimeError, "outside of an imported file"},
+		{"alias taken", "(var q 1) (import \"pricing\" :as q)", evaluator.NameError, "already defined: q"},
+		{"importer layer hidden", "(var hidden 1) (import \"peek\")", evaluator.NameError, "undefined: hidden"},
+	}
+	for _, c := range errCases {
+		_, err := e.EvalString(c.code)
+		var le *evaluator.Error
+		if !errors.As(err, &le) || le.Kind != c.kind || !strings.Contains(le.Message, c.message) {
+			t.Fatalf("%s: expect %v %q, got %v", c.name, c.kind, c.message, err)
+		}
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "greet.gl"), []byte(`(fn hello (name) (+ "hello " name))`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := evaluator.New()
+	e.AddModulePath(t.TempDir(), dir)
+	res, err := e.EvalString(`(import "greet") (greet/hello "ada")`)
+	if err != nil || res.String() != "hello ada" {
+		t.Fatalf("expect hello ada, got %v, %v", res, err)
+	}
+}
+
+func TestModulePrelude(t *testing.T) {
+	e := evaluator.WithPrelude()
+	e.AddModuleFS(modules)
+	res, err := e.EvalString(`(fn map (f xs) 'shadowed) (import "prelude" :as p) (p/doubles (list 1 2))`)
+	if err != nil || res.String() != "(2 4)" {
+		t.Fatalf("expect the prelude visible to modules, got %v, %v", res, err)
+	}
+}